@@ -0,0 +1,220 @@
+package commo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/jordan-wright/email"
+
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Size limits for the total size of the base64 encoded attachments of an email. The
+// SMTP limit is the most common limit of large providers (e.g. Gmail); the SendGrid
+// limit is the maximum size of a v3 mail send request.
+const (
+	MaxSMTPAttachmentSize     = 25 * 1024 * 1024
+	MaxSendGridAttachmentSize = 30 * 1024 * 1024
+)
+
+// Attachment dispositions
+const (
+	DispositionAttachment = "attachment"
+	DispositionInline     = "inline"
+)
+
+// Attachment is a file that is sent along with an email. The content is either
+// specified directly as bytes with Data or is read from Reader when the email is
+// prepared. A reader can only be read once, so an email with a Reader attachment can
+// only be prepared once; send the prepared Message to deliver it more than once. If the
+// ContentType is not specified it is detected from the filename extension or by
+// sniffing the content.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+	Reader      io.Reader
+	Inline      bool // if true the disposition is inline rather than attachment
+
+	// Set when the reader has been consumed so that it is not read again.
+	read atomic.Bool
+}
+
+// Attach adds the data as an attachment to the email. If the content type is empty,
+// it is detected from the filename or the data.
+func (e *Email) Attach(filename, contentType string, data []byte) *Attachment {
+	attachment := &Attachment{Filename: filename, ContentType: contentType, Data: data}
+	e.Attachments = append(e.Attachments, attachment)
+	return attachment
+}
+
+// AttachReader adds an attachment to the email whose content is read from the reader
+// when the email is prepared; the email can only be prepared once.
+func (e *Email) AttachReader(filename, contentType string, r io.Reader) *Attachment {
+	attachment := &Attachment{Filename: filename, ContentType: contentType, Reader: r}
+	e.Attachments = append(e.Attachments, attachment)
+	return attachment
+}
+
+// AttachFile reads the file at the specified path and adds it as an attachment to the
+// email using the base name of the path as the filename.
+func (e *Email) AttachFile(path string) (_ *Attachment, err error) {
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		return nil, err
+	}
+	return e.Attach(filepath.Base(path), "", data), nil
+}
+
+// Validate that the attachment has a filename, content, and a parseable content type.
+func (a *Attachment) Validate() error {
+	if a.Filename == "" {
+		return ErrMissingAttachmentName
+	}
+
+	if a.Data == nil && a.Reader == nil {
+		return fmt.Errorf("attachment %q: %w", a.Filename, ErrMissingAttachmentData)
+	}
+
+	if a.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(a.ContentType); err != nil {
+			return fmt.Errorf("attachment %q has invalid content type %q: %w", a.Filename, a.ContentType, ErrInvalidContentType)
+		}
+	}
+	return nil
+}
+
+// Disposition returns the content disposition of the attachment.
+func (a *Attachment) Disposition() string {
+	if a.Inline {
+		return DispositionInline
+	}
+	return DispositionAttachment
+}
+
+// Content returns the bytes of the attachment, reading them from the Reader if the
+// attachment was not created with Data. The attachment is not modified, so the reader
+// is consumed by the first call and ErrAttachmentRead is returned by later calls.
+func (a *Attachment) Content() (data []byte, err error) {
+	if a.Data != nil || a.Reader == nil {
+		return a.Data, nil
+	}
+
+	if a.read.Swap(true) {
+		return nil, fmt.Errorf("attachment %q: %w", a.Filename, ErrAttachmentRead)
+	}
+
+	if data, err = io.ReadAll(a.Reader); err != nil {
+		return nil, fmt.Errorf("could not read attachment %q: %w", a.Filename, err)
+	}
+	return data, nil
+}
+
+// Type returns the content type of the attachment, detecting it from the filename
+// extension or the content if it was not specified. Sniffing the content of a Reader
+// attachment consumes the reader.
+func (a *Attachment) Type() (_ string, err error) {
+	var data []byte
+	if a.ContentType == "" && mime.TypeByExtension(filepath.Ext(a.Filename)) == "" {
+		if data, err = a.Content(); err != nil {
+			return "", err
+		}
+	}
+	return a.detectType(data), nil
+}
+
+// Returns the content type of the attachment, sniffing the data if the type cannot be
+// determined from the attachment itself.
+func (a *Attachment) detectType(data []byte) string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+
+	if ctype := mime.TypeByExtension(filepath.Ext(a.Filename)); ctype != "" {
+		return ctype
+	}
+	return http.DetectContentType(data)
+}
+
+// Read the content of the attachments and ensure their base64 encoded size does not
+// exceed the limit of the provider the email is being sent with.
+func readAttachments(attachments []*Attachment, limit int) (_ [][]byte, err error) {
+	size := 0
+	contents := make([][]byte, 0, len(attachments))
+	for _, attachment := range attachments {
+		var data []byte
+		if data, err = attachment.Content(); err != nil {
+			return nil, err
+		}
+
+		size += base64.StdEncoding.EncodedLen(len(data))
+		if size > limit {
+			return nil, fmt.Errorf("attachments exceed %d bytes: %w", limit, ErrAttachmentTooLarge)
+		}
+		contents = append(contents, data)
+	}
+	return contents, nil
+}
+
+// Add the attachments to an email to be sent via SMTP. Inline attachments that are
+// referenced by the html body are added as related parts of the html.
+func attachSMTP(msg *email.Email, attachments []*Attachment) (err error) {
+	var contents [][]byte
+	if contents, err = readAttachments(attachments, MaxSMTPAttachmentSize); err != nil {
+		return err
+	}
+
+	for i, attachment := range attachments {
+		var ctype string
+		if ctype, err = attachment.Type(); err != nil {
+			return err
+		}
+
+		var at *email.Attachment
+		if at, err = msg.Attach(bytes.NewReader(contents[i]), attachment.Filename, ctype); err != nil {
+			return err
+		}
+
+		if attachment.Inline {
+			at.HTMLRelated = references(msg.HTML, attachment.Filename)
+			at.Header.Set("Content-Disposition", fmt.Sprintf("%s;\r\n filename=%q", DispositionInline, attachment.Filename))
+		}
+	}
+	return nil
+}
+
+// Add the attachments to an email to be sent via SendGrid.
+func attachSendGrid(msg *sgmail.SGMailV3, attachments []*Attachment) (err error) {
+	var contents [][]byte
+	if contents, err = readAttachments(attachments, MaxSendGridAttachmentSize); err != nil {
+		return err
+	}
+
+	for i, attachment := range attachments {
+		var ctype string
+		if ctype, err = attachment.Type(); err != nil {
+			return err
+		}
+
+		at := sgmail.NewAttachment()
+		at.SetContent(base64.StdEncoding.EncodeToString(contents[i]))
+		at.SetType(ctype)
+		at.SetFilename(attachment.Filename)
+		at.SetDisposition(attachment.Disposition())
+
+		// SendGrid requires a content id for inline attachments; like SMTP the
+		// filename is used as the content id that cid urls in the html refer to.
+		if attachment.Inline {
+			at.SetContentID(attachment.Filename)
+		}
+		msg.AddAttachment(at)
+	}
+	return nil
+}
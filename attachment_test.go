@@ -0,0 +1,225 @@
+package commo_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+	"go.rtnl.ai/commo/commotest"
+)
+
+func TestAttachmentType(t *testing.T) {
+	testCases := []struct {
+		attachment *commo.Attachment
+		expected   string
+	}{
+		{
+			&commo.Attachment{Filename: "invoice.pdf", ContentType: "application/x-custom", Data: []byte("data")},
+			"application/x-custom",
+		},
+		{
+			&commo.Attachment{Filename: "invoice.pdf", Data: []byte("data")},
+			"application/pdf",
+		},
+		{
+			&commo.Attachment{Filename: "export.csv", Data: []byte("a,b,c\n")},
+			"text/csv; charset=utf-8",
+		},
+		{
+			&commo.Attachment{Filename: "invoice", Data: []byte("%PDF-1.7\n")},
+			"application/pdf",
+		},
+		{
+			&commo.Attachment{Filename: "image", Reader: bytes.NewReader([]byte("\x89PNG\x0D\x0A\x1A\x0A"))},
+			"image/png",
+		},
+		{
+			&commo.Attachment{Filename: "unknown", Data: []byte{0x00, 0x01, 0x02}},
+			"application/octet-stream",
+		},
+	}
+
+	for i, tc := range testCases {
+		ctype, err := tc.attachment.Type()
+		require.NoError(t, err, "test case %d errored", i)
+		require.Equal(t, tc.expected, ctype, "test case %d failed", i)
+	}
+}
+
+func TestAttachmentContent(t *testing.T) {
+	attachment := &commo.Attachment{Filename: "report.txt", Data: []byte("quarterly report")}
+	for i := 0; i < 3; i++ {
+		data, err := attachment.Content()
+		require.NoError(t, err, "could not read attachment content")
+		require.Equal(t, []byte("quarterly report"), data)
+	}
+
+	// The reader is consumed once and the attachment is not modified.
+	attachment = &commo.Attachment{Filename: "report.txt", Reader: strings.NewReader("quarterly report")}
+	data, err := attachment.Content()
+	require.NoError(t, err, "could not read attachment content")
+	require.Equal(t, []byte("quarterly report"), data)
+	require.Nil(t, attachment.Data)
+
+	_, err = attachment.Content()
+	require.ErrorIs(t, err, commo.ErrAttachmentRead)
+}
+
+func TestAttachmentConcurrentPrepare(t *testing.T) {
+	mailer, err := commo.NewMailer(commo.Config{Sender: "jane@example.com"}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	email, err := mailer.New("tess@example.com", "Attachments", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+	email.Attach("invoice", "", []byte("%PDF-1.7\n"))
+
+	// Emails with data attachments can be prepared concurrently.
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg, err := email.Prepare()
+			require.NoError(t, err, "could not prepare email")
+			require.Equal(t, "application/pdf", msg.Attachments()[0].ContentType)
+		}()
+	}
+	wg.Wait()
+
+	// Only one of the concurrent prepares can read a reader attachment.
+	email.AttachReader("notes", "", strings.NewReader("some notes"))
+
+	var prepared, failed atomic.Int32
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := email.Prepare(); err != nil {
+				require.ErrorIs(t, err, commo.ErrAttachmentRead)
+				failed.Add(1)
+				return
+			}
+			prepared.Add(1)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), prepared.Load())
+	require.Equal(t, int32(7), failed.Load())
+}
+
+func TestAttachmentValidate(t *testing.T) {
+	testCases := []struct {
+		attachment *commo.Attachment
+		err        error
+	}{
+		{&commo.Attachment{Filename: "report.txt", Data: []byte("report")}, nil},
+		{&commo.Attachment{Filename: "report.txt", Data: []byte{}}, nil},
+		{&commo.Attachment{Filename: "report.txt", Reader: strings.NewReader("report")}, nil},
+		{&commo.Attachment{Data: []byte("report")}, commo.ErrMissingAttachmentName},
+		{&commo.Attachment{Filename: "report.txt"}, commo.ErrMissingAttachmentData},
+		{&commo.Attachment{Filename: "report.txt", ContentType: "text/", Data: []byte("report")}, commo.ErrInvalidContentType},
+	}
+
+	for i, tc := range testCases {
+		if tc.err == nil {
+			require.NoError(t, tc.attachment.Validate(), "test case %d failed", i)
+		} else {
+			require.ErrorIs(t, tc.attachment.Validate(), tc.err, "test case %d failed", i)
+		}
+	}
+
+	email := &commo.Email{
+		Sender:      "admin@server.com",
+		To:          []string{"test@example.com"},
+		Subject:     "This is a test email",
+		Template:    "test",
+		Attachments: []*commo.Attachment{{Filename: "report.txt"}},
+	}
+	require.ErrorIs(t, email.Validate(), commo.ErrMissingAttachmentData)
+}
+
+func TestEmailAttachments(t *testing.T) {
+	mailer, err := commo.NewMailer(commo.Config{}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	path := filepath.Join(t.TempDir(), "export.csv")
+	require.NoError(t, os.WriteFile(path, []byte("a,b,c\n1,2,3\n"), 0644))
+
+	email, err := mailer.New("tess@example.com", "Attachments", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+	email.Sender = "jane@example.com"
+	email.Attach("invoice.pdf", "", []byte("%PDF-1.7\n"))
+	email.AttachReader("notes.txt", "text/plain", strings.NewReader("some notes")).Inline = true
+	_, err = email.AttachFile(path)
+	require.NoError(t, err, "could not attach file")
+
+	// The reader attachment is consumed when the email is prepared.
+	prepared, err := email.Prepare()
+	require.NoError(t, err, "could not prepare email")
+
+	_, err = email.Prepare()
+	require.ErrorIs(t, err, commo.ErrAttachmentRead)
+
+	t.Run("SMTP", func(t *testing.T) {
+		msg, err := prepared.ToSMTP()
+		require.NoError(t, err, "could not create smtp email")
+		require.Len(t, msg.Attachments, 3)
+
+		raw, err := msg.Bytes()
+		require.NoError(t, err, "could not render smtp email")
+
+		parsed, err := commotest.ParseMessage(raw)
+		require.NoError(t, err, "could not parse smtp email")
+		require.NotEmpty(t, parsed.Text)
+		require.NotEmpty(t, parsed.HTML)
+		require.Equal(t, []commotest.Attachment{
+			{Filename: "invoice.pdf", ContentType: "application/pdf", ContentID: "invoice.pdf", Disposition: "attachment", Content: []byte("%PDF-1.7\n")},
+			{Filename: "notes.txt", ContentType: "text/plain", ContentID: "notes.txt", Disposition: "inline", Content: []byte("some notes")},
+			{Filename: "export.csv", ContentType: "text/csv", ContentID: "export.csv", Disposition: "attachment", Content: []byte("a,b,c\n1,2,3\n")},
+		}, parsed.Attachments)
+	})
+
+	t.Run("SendGrid", func(t *testing.T) {
+		msg, err := prepared.ToSendGrid()
+		require.NoError(t, err, "could not create sendgrid email")
+		require.Len(t, msg.Attachments, 3)
+		require.Empty(t, commotest.ValidateSendGrid(msg))
+
+		require.Equal(t, "invoice.pdf", msg.Attachments[0].Filename)
+		require.Equal(t, "application/pdf", msg.Attachments[0].Type)
+		require.Equal(t, "attachment", msg.Attachments[0].Disposition)
+		require.Equal(t, base64.StdEncoding.EncodeToString([]byte("%PDF-1.7\n")), msg.Attachments[0].Content)
+
+		require.Equal(t, "notes.txt", msg.Attachments[1].Filename)
+		require.Equal(t, "inline", msg.Attachments[1].Disposition)
+		require.Equal(t, "notes.txt", msg.Attachments[1].ContentID)
+		require.Equal(t, base64.StdEncoding.EncodeToString([]byte("some notes")), msg.Attachments[1].Content)
+
+		require.Equal(t, "text/csv; charset=utf-8", msg.Attachments[2].Type)
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		email, err := mailer.New("tess@example.com", "Attachments", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		email.Sender = "jane@example.com"
+		email.Attach("large.bin", "", make([]byte, commo.MaxSMTPAttachmentSize/4*3+1))
+
+		_, err = email.ToSMTP()
+		require.ErrorIs(t, err, commo.ErrAttachmentTooLarge)
+
+		// The SendGrid limit is larger than the SMTP limit
+		_, err = email.ToSendGrid()
+		require.NoError(t, err)
+
+		email.Attach("large2.bin", "", make([]byte, commo.MaxSMTPAttachmentSize/4))
+		_, err = email.ToSendGrid()
+		require.ErrorIs(t, err, commo.ErrAttachmentTooLarge)
+	})
+}
@@ -0,0 +1,38 @@
+package commo
+
+import "context"
+
+// Backend is the transport used to deliver emails. commo ships with SMTP and SendGrid
+// backends that are created from the Config when Initialize is called, but any type
+// that implements this interface can be supplied to InitializeWithBackend to deliver
+// messages using a custom transport.
+type Backend interface {
+	// Send delivers a message that has been validated and rendered by the mailer. Send
+	// is called from inside of the retry loop, so it should return an error if the
+	// delivery attempt failed and may be retried, and must return once the context is
+	// done; the error should wrap ctx.Err() if the attempt was cancelled.
+	Send(context.Context, *Message) error
+
+	// Name returns a short, human readable identifier of the backend, e.g. "smtp".
+	Name() string
+
+	// Close releases any resources (such as connections) held by the backend. The
+	// backend should not be used to send emails after it has been closed.
+	Close() error
+}
+
+// Create the backend described by the configuration. The configuration should be
+// validated before this function is called. In testing mode a mock backend is always
+// returned to ensure that no live emails are sent.
+func newBackend(conf Config) (Backend, error) {
+	switch {
+	case conf.Testing:
+		return NewMockBackend(), nil
+	case conf.SMTP.Enabled():
+		return NewSMTPBackend(conf)
+	case conf.SendGrid.Enabled():
+		return NewSendGridBackend(conf)
+	default:
+		return nil, ErrNoBackend
+	}
+}
@@ -0,0 +1,594 @@
+package commo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Message catalogs keyed by locale that back the t and plural template functions.
+// Catalogs are stored as JSON files or gettext .po files named by their locale, e.g.
+// locales/fr.json or locales/fr-CA.po. JSON catalogs map a message id to its
+// translation or to its plural forms keyed by CLDR plural category:
+//
+//	{
+//	  "Welcome!": "Bienvenue !",
+//	  "%d item": {"one": "%d article", "other": "%d articles"}
+//	}
+type catalogs struct {
+	locales map[string]*catalog
+}
+
+type catalog struct {
+	messages map[string]*message
+	plural   func(n int) int // the plural form index of .po catalogs
+}
+
+type message struct {
+	text       string
+	forms      []string          // plural forms of .po catalogs by index
+	categories map[string]string // plural forms of JSON catalogs by CLDR category
+}
+
+// Load the catalogs in the directory of the file system; if the directory does not
+// exist then no catalogs are loaded.
+func loadCatalogs(fsys fs.FS, dir string) (_ *catalogs, err error) {
+	var entries []fs.DirEntry
+	if entries, err = fs.ReadDir(fsys, dir); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read catalogs directory: %w", err)
+	}
+
+	cats := &catalogs{locales: make(map[string]*catalog)}
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".json" && ext != ".po") {
+			continue
+		}
+
+		base := strings.TrimSuffix(entry.Name(), ext)
+		if !isLocale(base) {
+			return nil, fmt.Errorf("catalog %q is not named by its locale: %w", entry.Name(), ErrInvalidCatalog)
+		}
+
+		var data []byte
+		if data, err = fs.ReadFile(fsys, path.Join(dir, entry.Name())); err != nil {
+			return nil, err
+		}
+
+		var cat *catalog
+		switch ext {
+		case ".json":
+			cat, err = parseJSONCatalog(data)
+		case ".po":
+			cat, err = parsePOCatalog(data)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("could not parse catalog %q: %w: %w", entry.Name(), ErrInvalidCatalog, err)
+		}
+		cats.add(NormalizeLocale(base), cat)
+	}
+	return cats, nil
+}
+
+// Add the catalog to the locale, merging it with any catalog already loaded.
+func (c *catalogs) add(locale string, cat *catalog) {
+	existing, ok := c.locales[locale]
+	if !ok {
+		c.locales[locale] = cat
+		return
+	}
+
+	for id, msg := range cat.messages {
+		existing.messages[id] = msg
+	}
+
+	if cat.plural != nil {
+		existing.plural = cat.plural
+	}
+}
+
+// Returns the locales that have catalogs.
+func (c *catalogs) tags() []string {
+	if c == nil {
+		return nil
+	}
+
+	locales := make([]string, 0, len(c.locales))
+	for locale := range c.locales {
+		locales = append(locales, locale)
+	}
+	return locales
+}
+
+// Translate the message for the locale, falling back to less specific locales and then
+// to the message id if there is no translation.
+func (c *catalogs) translate(locale, msgid string) string {
+	if c == nil {
+		return msgid
+	}
+
+	for _, tag := range localeChain(locale) {
+		if cat, ok := c.locales[tag]; ok {
+			if msg, ok := cat.messages[msgid]; ok && msg.text != "" {
+				return msg.text
+			}
+		}
+	}
+	return msgid
+}
+
+// Returns the plural form of the message for the count in the locale, falling back to
+// less specific locales and then to the singular or plural message id.
+func (c *catalogs) plural(locale, singular, plural string, n int) string {
+	if c != nil {
+		for _, tag := range localeChain(locale) {
+			cat, ok := c.locales[tag]
+			if !ok {
+				continue
+			}
+
+			msg, ok := cat.messages[singular]
+			if !ok {
+				continue
+			}
+
+			if len(msg.forms) > 0 {
+				form := 0
+				if cat.plural != nil {
+					form = cat.plural(n)
+				} else if n != 1 {
+					form = 1
+				}
+
+				if form >= 0 && form < len(msg.forms) && msg.forms[form] != "" {
+					return msg.forms[form]
+				}
+			}
+
+			if msg.categories != nil {
+				if form, ok := msg.categories[pluralCategory(tag, n)]; ok {
+					return form
+				}
+
+				if form, ok := msg.categories["other"]; ok {
+					return form
+				}
+			}
+		}
+	}
+
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// Returns the CLDR plural category of the count for the language of the locale.
+func pluralCategory(locale string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+
+	switch language(locale) {
+	case "ja", "ko", "zh", "vi", "th", "id", "ms":
+		return "other"
+	case "fr", "pt":
+		if n == 0 || n == 1 {
+			return "one"
+		}
+		return "other"
+	case "ru", "uk", "be":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "pl":
+		switch {
+		case n == 1:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "cs", "sk":
+		switch {
+		case n == 1:
+			return "one"
+		case n >= 2 && n <= 4:
+			return "few"
+		default:
+			return "other"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+func parseJSONCatalog(data []byte) (_ *catalog, err error) {
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	cat := &catalog{messages: make(map[string]*message, len(raw))}
+	for id, value := range raw {
+		var text string
+		if err = json.Unmarshal(value, &text); err == nil {
+			cat.messages[id] = &message{text: text}
+			continue
+		}
+
+		var categories map[string]string
+		if err = json.Unmarshal(value, &categories); err != nil {
+			return nil, fmt.Errorf("message %q must be a string or an object of plural forms", id)
+		}
+
+		msg := &message{categories: categories, text: categories["one"]}
+		if msg.text == "" {
+			msg.text = categories["other"]
+		}
+		cat.messages[id] = msg
+	}
+	return cat, nil
+}
+
+// A gettext .po entry that is being parsed.
+type poEntry struct {
+	ctx      string
+	id       string
+	idPlural string
+	str      string
+	strs     []string
+	fuzzy    bool
+}
+
+// Returns true if the translation of the entry has been read, so the next msgctxt,
+// msgid, or flags comment starts a new entry.
+func (e *poEntry) translated() bool {
+	return e.str != "" || len(e.strs) > 0
+}
+
+func parsePOCatalog(data []byte) (_ *catalog, err error) {
+	var (
+		cat   = &catalog{messages: make(map[string]*message)}
+		entry = &poEntry{}
+		field *string
+	)
+
+	flush := func() (err error) {
+		defer func() { entry, field = &poEntry{}, nil }()
+		if entry.fuzzy {
+			return nil
+		}
+
+		// The header entry has an empty id and describes the plural forms.
+		if entry.id == "" {
+			for _, line := range strings.Split(entry.str, "\n") {
+				if key, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(key), "Plural-Forms") {
+					if cat.plural, err = parsePluralForms(value); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+
+		id := entry.id
+		if entry.ctx != "" {
+			id = entry.ctx + "\x04" + id
+		}
+
+		switch {
+		case entry.idPlural == "" && entry.str != "":
+			cat.messages[id] = &message{text: entry.str}
+		case entry.idPlural != "" && len(entry.strs) > 0 && entry.strs[0] != "":
+			cat.messages[id] = &message{text: entry.strs[0], forms: entry.strs}
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			if err = flush(); err != nil {
+				return nil, err
+			}
+			continue
+		case strings.HasPrefix(line, "#,"):
+			if entry.translated() {
+				if err = flush(); err != nil {
+					return nil, err
+				}
+			}
+			entry.fuzzy = entry.fuzzy || strings.Contains(line, "fuzzy")
+			continue
+		case strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, `"`):
+			// Continuation of the string of the previous keyword.
+			if field == nil {
+				return nil, fmt.Errorf("line %d: string without a keyword", lineno)
+			}
+
+			var str string
+			if str, err = strconv.Unquote(line); err != nil {
+				return nil, fmt.Errorf("line %d: could not parse string %s", lineno, line)
+			}
+			*field += str
+			continue
+		}
+
+		keyword, value, _ := strings.Cut(line, " ")
+		var str string
+		if str, err = strconv.Unquote(strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("line %d: could not parse string %s", lineno, value)
+		}
+
+		// Entries are not required to be separated by blank lines.
+		if (keyword == "msgctxt" || keyword == "msgid") && entry.translated() {
+			if err = flush(); err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case keyword == "msgctxt":
+			entry.ctx, field = str, &entry.ctx
+		case keyword == "msgid":
+			entry.id, field = str, &entry.id
+		case keyword == "msgid_plural":
+			entry.idPlural, field = str, &entry.idPlural
+		case keyword == "msgstr":
+			entry.str, field = str, &entry.str
+		case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+			if i, err := strconv.Atoi(keyword[7 : len(keyword)-1]); err != nil || i != len(entry.strs) {
+				return nil, fmt.Errorf("line %d: plural forms must be numbered in order, got %s", lineno, keyword)
+			}
+			entry.strs = append(entry.strs, str)
+			field = &entry.strs[len(entry.strs)-1]
+		default:
+			return nil, fmt.Errorf("line %d: unknown keyword %q", lineno, keyword)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = flush(); err != nil {
+		return nil, err
+	}
+	return cat, nil
+}
+
+// Parse the plural expression of a gettext Plural-Forms header, e.g.
+// "nplurals=2; plural=(n != 1);", into a function that returns the plural form index.
+func parsePluralForms(header string) (_ func(n int) int, err error) {
+	var expr string
+	for _, part := range strings.Split(header, ";") {
+		if key, value, ok := strings.Cut(part, "="); ok && strings.TrimSpace(key) == "plural" {
+			expr = value
+		}
+	}
+
+	if strings.TrimSpace(expr) == "" {
+		return nil, fmt.Errorf("missing plural expression in %q", header)
+	}
+
+	p := &pluralParser{src: expr}
+	var eval func(n int) int
+	if eval, err = p.ternary(); err != nil {
+		return nil, err
+	}
+
+	if p.skip(); p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q in plural expression", p.src[p.pos:])
+	}
+	return eval, nil
+}
+
+// A recursive descent parser for the C expressions of gettext plural forms.
+type pluralParser struct {
+	src string
+	pos int
+}
+
+type pluralFunc = func(n int) int
+
+// Binary operators by precedence from lowest to highest.
+var pluralOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<=", ">=", "<", ">"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *pluralParser) skip() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *pluralParser) accept(tok string) bool {
+	p.skip()
+	if strings.HasPrefix(p.src[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *pluralParser) ternary() (_ pluralFunc, err error) {
+	var cond, yes, no pluralFunc
+	if cond, err = p.binary(0); err != nil {
+		return nil, err
+	}
+
+	if !p.accept("?") {
+		return cond, nil
+	}
+
+	if yes, err = p.ternary(); err != nil {
+		return nil, err
+	}
+
+	if !p.accept(":") {
+		return nil, errors.New("expected : in plural expression")
+	}
+
+	if no, err = p.ternary(); err != nil {
+		return nil, err
+	}
+
+	return func(n int) int {
+		if cond(n) != 0 {
+			return yes(n)
+		}
+		return no(n)
+	}, nil
+}
+
+func (p *pluralParser) binary(level int) (_ pluralFunc, err error) {
+	if level == len(pluralOperators) {
+		return p.unary()
+	}
+
+	var left pluralFunc
+	if left, err = p.binary(level + 1); err != nil {
+		return nil, err
+	}
+
+	for {
+		op := ""
+		for _, candidate := range pluralOperators[level] {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+
+		if op == "" {
+			return left, nil
+		}
+
+		var right pluralFunc
+		if right, err = p.binary(level + 1); err != nil {
+			return nil, err
+		}
+		left = pluralOperator(op, left, right)
+	}
+}
+
+func pluralOperator(op string, left, right pluralFunc) pluralFunc {
+	bool2int := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	return func(n int) int {
+		a, b := left(n), right(n)
+		switch op {
+		case "||":
+			return bool2int(a != 0 || b != 0)
+		case "&&":
+			return bool2int(a != 0 && b != 0)
+		case "==":
+			return bool2int(a == b)
+		case "!=":
+			return bool2int(a != b)
+		case "<=":
+			return bool2int(a <= b)
+		case ">=":
+			return bool2int(a >= b)
+		case "<":
+			return bool2int(a < b)
+		case ">":
+			return bool2int(a > b)
+		case "+":
+			return a + b
+		case "-":
+			return a - b
+		case "*":
+			return a * b
+		case "/", "%":
+			if b == 0 {
+				return 0
+			}
+
+			if op == "/" {
+				return a / b
+			}
+			return a % b
+		}
+		return 0
+	}
+}
+
+func (p *pluralParser) unary() (_ pluralFunc, err error) {
+	if p.accept("!") {
+		var operand pluralFunc
+		if operand, err = p.unary(); err != nil {
+			return nil, err
+		}
+
+		return func(n int) int {
+			if operand(n) == 0 {
+				return 1
+			}
+			return 0
+		}, nil
+	}
+
+	if p.accept("(") {
+		var inner pluralFunc
+		if inner, err = p.ternary(); err != nil {
+			return nil, err
+		}
+
+		if !p.accept(")") {
+			return nil, errors.New("expected ) in plural expression")
+		}
+		return inner, nil
+	}
+
+	if p.accept("n") {
+		return func(n int) int { return n }, nil
+	}
+
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+
+	if start == p.pos {
+		return nil, fmt.Errorf("unexpected %q in plural expression", p.src[start:])
+	}
+
+	value, _ := strconv.Atoi(p.src[start:p.pos])
+	return func(int) int { return value }, nil
+}
@@ -8,9 +8,9 @@ Usage Example:
 	err := confire.Process("commo_email", &conf)
 	checkErr(err)
 
-	// Load templates
-	var templates map[string]*template.Template
-	templates = ... // not shown here; see `commo/commo_test.go` for full example
+	// Load templates from an embed.FS or os.DirFS
+	templates, err := commo.LoadTemplates(os.DirFS("templates"), commo.DefaultLayout)
+	checkErr(err)
 
 	// Initialize commo
 	err = commo.Initialize(conf, templates)
@@ -33,24 +33,13 @@ package commo
 
 import (
 	"context"
-	"errors"
-	"html/template"
-
-	"github.com/jordan-wright/email"
-	"go.rtnl.ai/x/backoff"
-
-	"github.com/sendgrid/rest"
-	"github.com/sendgrid/sendgrid-go"
-	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+	"sync"
 )
 
-// Package level variables
+// The default mailer used by the package level functions.
 var (
-	initialized bool
-	config      Config
-	templs      map[string]*template.Template
-	pool        *email.Pool
-	sg          *sendgrid.Client
+	mu  sync.RWMutex
+	std = &Mailer{images: newInlineImages()}
 )
 
 // Config for [backoff.ExponentialBackOff]
@@ -61,117 +50,104 @@ const (
 
 // Initialize the package to start sending emails. If there is no valid email
 // configuration available then configuration is gracefully ignored without error.
-func Initialize(conf Config, templates map[string]*template.Template) (err error) {
+// In testing mode emails are captured by a MockBackend that is available from Mock.
+func Initialize(conf Config, templates *Templates) (err error) {
 	// Do not configure email if it is not available but also do not return an error.
-	if !conf.Available() {
+	if !conf.Available() && !conf.Testing {
 		return nil
 	}
 
-	if err = conf.Validate(); err != nil {
+	var m *Mailer
+	if m, err = NewMailer(conf, templates); err != nil {
 		return err
 	}
 
-	// TODO: if in testing mode create a mock for sending emails.
-
-	if conf.SMTP.Enabled() {
-		if pool, err = conf.SMTP.Pool(); err != nil {
-			return err
-		}
-	}
+	setDefault(m)
+	return nil
+}
 
-	if conf.SendGrid.Enabled() {
-		sg = conf.SendGrid.Client()
+// InitializeWithBackend initializes the package to send emails using the specified
+// backend rather than the backend described by the configuration. The configuration
+// is still used for the default sender and the retry behavior of Send.
+func InitializeWithBackend(conf Config, b Backend, templates *Templates) (err error) {
+	var m *Mailer
+	if m, err = NewMailerWithBackend(conf, b, templates); err != nil {
+		return err
 	}
 
-	config = conf
-	templs = templates
-	initialized = true
+	setDefault(m)
 	return nil
 }
 
 // Loads templates into commo's internal template storage. Useful for testing.
-func WithTemplates(templates map[string]*template.Template) {
-	templs = templates
+func WithTemplates(templates *Templates) {
+	mu.Lock()
+	defer mu.Unlock()
+	std = &Mailer{conf: std.conf, templs: strict(std.conf, templates), images: std.images, backend: std.backend}
 }
 
-// Send an email using the configured send methodology. Uses exponential backoff to
-// retry multiple times on error with an increasing delay between attempts.
-func Send(email *Email) (err error) {
-	// The package must be initialized to send.
-	if !initialized {
-		return ErrNotInitialized
-	}
-
-	// Select the send function to deliver the email with.
-	var send sender
-	switch {
-	case config.SMTP.Enabled():
-		send = sendSMTP
-	case config.SendGrid.Enabled():
-		send = sendSendGrid
-	case config.Testing:
-		send = sendMock
-	default:
-		panic("unhandled send email method")
-	}
-
-	exponential := backoff.ExponentialBackOff{
-		InitialInterval:     config.Backoff.InitialInterval,
-		RandomizationFactor: randomizationFactor,
-		Multiplier:          multiplier,
-		MaxInterval:         config.Backoff.MaxInterval,
-	}
-
-	// Attempt to send the message with multiple retries.
-	if _, err = backoff.Retry(context.Background(), func() (any, serr error) {
-		serr = send(email)
-		return nil, serr
-	},
-		backoff.WithBackOff(&exponential),
-		backoff.WithMaxElapsedTime(config.Backoff.MaxElapsedTime),
-	); err != nil {
-		return err
-	}
+// Localized returns a mailer that renders emails in the specified locale using the
+// configuration, templates, and backend of the default mailer. See Mailer.Localized.
+func Localized(locale string) *Mailer {
+	return defaultMailer().Localized(locale)
+}
 
-	return nil
+// Send an email using the configured backend. Uses exponential backoff to retry
+// multiple times on error with an increasing delay between attempts.
+func Send(email *Email) (err error) {
+	return defaultMailer().Send(email)
+}
 
+// SendContext sends an email using the configured backend, stopping the retries when
+// the context is cancelled or its deadline is exceeded. See Mailer.SendContext.
+func SendContext(ctx context.Context, email *Email) (err error) {
+	return defaultMailer().SendContext(ctx, email)
 }
 
-type sender func(*Email) error
+// SendMessage delivers a prepared message using the configured backend, retrying like
+// SendContext. See Mailer.SendMessage.
+func SendMessage(ctx context.Context, msg *Message) (err error) {
+	return defaultMailer().SendMessage(ctx, msg)
+}
 
-func sendSMTP(e *Email) (err error) {
-	var msg *email.Email
-	if msg, err = e.ToSMTP(); err != nil {
-		return err
-	}
+// Close the backend of the default mailer. The package must be initialized again
+// before any more emails can be sent.
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
 
-	if err = pool.Send(msg, config.Backoff.Timeout); err != nil {
-		return err
-	}
-	return nil
+	err := std.Close()
+	std = &Mailer{templs: std.templs, images: std.images}
+	return err
 }
 
-func sendSendGrid(e *Email) (err error) {
-	var msg *sgmail.SGMailV3
-	if msg, err = e.ToSendGrid(); err != nil {
-		return err
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), config.Backoff.Timeout)
-	defer cancel()
+// Mock returns the mock backend of the default mailer when the package has been
+// initialized in testing mode, otherwise nil.
+func Mock() *MockBackend {
+	return defaultMailer().Mock()
+}
 
-	var rep *rest.Response
-	if rep, err = sg.SendWithContext(ctx, msg); err != nil {
-		return err
-	}
+func defaultMailer() *Mailer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return std
+}
 
-	if rep.StatusCode < 200 || rep.StatusCode >= 300 {
-		return errors.New(rep.Body)
+// Replace the default mailer; the inline images registered with the previous default
+// mailer (e.g. with Embed before the package is initialized) are carried over.
+func setDefault(m *Mailer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	std.images.RLock()
+	m.images.Lock()
+	for name, image := range std.images.images {
+		if _, ok := m.images.images[name]; !ok {
+			m.images.images[name] = image
+		}
 	}
+	m.images.Unlock()
+	std.images.RUnlock()
 
-	return nil
-}
-
-func sendMock(*Email) (err error) {
-	return errors.New("not implemented")
+	std = m
 }
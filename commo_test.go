@@ -1,11 +1,10 @@
 package commo_test
 
 import (
+	"context"
 	"embed"
-	"html/template"
-	"io/fs"
+	"errors"
 	"os"
-	"path/filepath"
 	"strings"
 	"testing"
 
@@ -46,10 +45,71 @@ func TestLiveEmails(t *testing.T) {
 	})
 }
 
+func TestInitializeWithBackend(t *testing.T) {
+	conf := commo.Config{
+		Sender:  "Peony Quarterdeck <peony@example.com>",
+		Backoff: fastBackoff(),
+	}
+
+	t.Run("NilBackend", func(t *testing.T) {
+		err := commo.InitializeWithBackend(conf, nil, loadTestTemplates())
+		require.ErrorIs(t, err, commo.ErrNoBackend)
+	})
+
+	t.Run("Send", func(t *testing.T) {
+		backend := &recordingBackend{}
+		err := commo.InitializeWithBackend(conf, backend, loadTestTemplates())
+		require.NoError(t, err, "could not initialize with custom backend")
+
+		email, err := commo.New("test@example.com", "Test Subject", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		require.Equal(t, conf.Sender, email.Sender)
+
+		err = email.Send()
+		require.NoError(t, err, "could not send email")
+		require.Len(t, backend.sent, 1)
+		require.Equal(t, email.Subject, backend.sent[0].Subject())
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		backend := &recordingBackend{fails: 2}
+		err := commo.InitializeWithBackend(conf, backend, loadTestTemplates())
+		require.NoError(t, err, "could not initialize with custom backend")
+
+		email, err := commo.New("test@example.com", "Test Subject", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		err = email.Send()
+		require.NoError(t, err, "could not send email")
+		require.Equal(t, 3, backend.calls)
+		require.Len(t, backend.sent, 1)
+	})
+}
+
 // ############################################################################
 // Helpers
 // ############################################################################
 
+// A backend that records all of the messages it is asked to send, failing the first
+// fails number of attempts.
+type recordingBackend struct {
+	fails int
+	calls int
+	sent  []*commo.Message
+}
+
+func (b *recordingBackend) Send(_ context.Context, msg *commo.Message) error {
+	b.calls++
+	if b.calls <= b.fails {
+		return errors.New("transient failure")
+	}
+	b.sent = append(b.sent, msg)
+	return nil
+}
+
+func (b *recordingBackend) Name() string { return "recording" }
+func (b *recordingBackend) Close() error { return nil }
+
 func CheckEnvVars(t *testing.T, envs ...string) {
 	for _, env := range envs {
 		require.NotEmpty(t, os.Getenv(env), "required environment variable $%s not set", env)
@@ -70,44 +130,12 @@ func SkipByEnvVar(t *testing.T, env string) {
 // Test Template Loading
 // ############################################################################
 
-const (
-	templatesDir = "testdata/templates"
-	partialsDir  = "partials"
-)
-
 var (
 	//go:embed testdata/templates/*.html testdata/templates/*.txt testdata/templates/partials/*html
 	files embed.FS
 )
 
 // Load templates
-func loadTestTemplates() map[string]*template.Template {
-	var (
-		err           error
-		templateFiles []fs.DirEntry
-	)
-
-	templates := make(map[string]*template.Template)
-	if templateFiles, err = fs.ReadDir(files, templatesDir); err != nil {
-		panic(err)
-	}
-
-	// Each template needs to be parsed independently to ensure that define directives
-	// are not overriden if they have the same name; e.g. to use the base template.
-	for _, file := range templateFiles {
-		if file.IsDir() {
-			continue
-		}
-
-		// Each template will be accessible by its base name in the global map
-		patterns := make([]string, 0, 2)
-		patterns = append(patterns, filepath.Join(templatesDir, file.Name()))
-		switch filepath.Ext(file.Name()) {
-		case ".html":
-			patterns = append(patterns, filepath.Join(templatesDir, partialsDir, "*.html"))
-		}
-
-		templates[file.Name()] = template.Must(template.ParseFS(files, patterns...))
-	}
-	return templates
+func loadTestTemplates() *commo.Templates {
+	return commo.MustLoadTemplates(files, commo.Layout{Dir: "testdata/templates"})
 }
@@ -0,0 +1,76 @@
+/*
+Package commotest provides local, in-process stand-ins for the email services used by
+commo so that the full send path can be tested in CI without network access or live
+credentials. The servers in this package listen on loopback addresses, record the
+messages that they receive, and can be scripted to return errors.
+
+Usage Example:
+
+	srv := commotest.NewSMTPServer()
+	defer srv.Close()
+
+	conf := commo.Config{
+		Sender: "test@example.com",
+		SMTP:   srv.Config(),
+		...
+	}
+
+	// ... send emails ...
+
+	msgs := srv.Messages()
+*/
+package commotest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"time"
+)
+
+// Generates a self-signed certificate that is valid for the loopback addresses so
+// that the test servers can be used with TLS.
+func selfSignedCertificate() (_ tls.Certificate, err error) {
+	var key *ecdsa.PrivateKey
+	if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	var serial *big.Int
+	if serial, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"commotest"}},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	var der []byte
+	if der, err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cert := tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+
+	if cert.Leaf, err = x509.ParseCertificate(der); err != nil {
+		return tls.Certificate{}, err
+	}
+	return cert, nil
+}
@@ -0,0 +1,117 @@
+package commotest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// Message is an email received by a test server, parsed from its MIME source so that
+// tests can make assertions about the headers, bodies, and attachments.
+type Message struct {
+	From        string       // envelope sender (MAIL FROM)
+	Recipients  []string     // envelope recipients (RCPT TO), including Bcc recipients
+	Header      mail.Header  // top level headers of the message
+	Subject     string       // decoded subject header
+	Text        string       // decoded text/plain body
+	HTML        string       // decoded text/html body
+	Attachments []Attachment // all non-body parts, including inline related parts
+	Raw         []byte       // the MIME source of the message as received
+}
+
+// Attachment is a non-body MIME part of a received message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	ContentID   string
+	Disposition string
+	Content     []byte
+}
+
+// ParseMessage parses the MIME source of an email, decoding the text and html bodies
+// and any attachments in multipart messages.
+func ParseMessage(raw []byte) (msg *Message, err error) {
+	var parsed *mail.Message
+	if parsed, err = mail.ReadMessage(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+
+	msg = &Message{
+		Header: parsed.Header,
+		Raw:    raw,
+	}
+
+	dec := &mime.WordDecoder{}
+	if msg.Subject, err = dec.DecodeHeader(parsed.Header.Get("Subject")); err != nil {
+		return nil, err
+	}
+
+	if err = msg.walk(textproto.MIMEHeader(parsed.Header), parsed.Body); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Recursively walk the MIME parts of the message to collect the bodies and attachments.
+func (m *Message) walk(header textproto.MIMEHeader, body io.Reader) (err error) {
+	mediaType, params, perr := mime.ParseMediaType(header.Get("Content-Type"))
+	if perr != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			var part *multipart.Part
+			if part, err = reader.NextRawPart(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+
+			if err = m.walk(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	var content []byte
+	if content, err = io.ReadAll(body); err != nil {
+		return err
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if disposition == "" || (disposition == "inline" && dparams["filename"] == "") {
+		switch mediaType {
+		case "text/plain":
+			m.Text += string(content)
+			return nil
+		case "text/html":
+			m.HTML += string(content)
+			return nil
+		}
+	}
+
+	m.Attachments = append(m.Attachments, Attachment{
+		Filename:    dparams["filename"],
+		ContentType: mediaType,
+		ContentID:   strings.Trim(header.Get("Content-ID"), "<>"),
+		Disposition: disposition,
+		Content:     content,
+	})
+	return nil
+}
@@ -0,0 +1,370 @@
+package commotest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+	"go.rtnl.ai/commo"
+)
+
+// SendGridEndpoint is the path of the SendGrid v3 mail send API.
+const SendGridEndpoint = "/v3/mail/send"
+
+// SendGrid limits that are validated by the server.
+const (
+	maxPersonalizations = 1000
+	maxRecipients       = 1000
+	maxMessageSize      = 30 * 1024 * 1024
+)
+
+// SendGridServer is a local stand-in for the SendGrid v3 mail send API built on
+// [httptest.Server]. It validates the JSON payload of each request the way that
+// SendGrid does, stores accepted messages, and can be scripted to return errors
+// such as bad requests, rate limits, and server errors.
+type SendGridServer struct {
+	*httptest.Server
+	APIKey string // if set, requests must be authorized with this key
+
+	mu        sync.Mutex
+	messages  []*sgmail.SGMailV3
+	responses []*SendGridResponse
+	requests  int
+}
+
+// SendGridResponse is a scripted response that the server sends instead of handling
+// the request normally.
+type SendGridResponse struct {
+	StatusCode int               // the HTTP status code of the response
+	Errors     []SendGridError   // the errors returned in the body of the response
+	Header     map[string]string // additional headers to set on the response
+	Delay      time.Duration     // time to wait before responding, e.g. to test timeouts
+	Times      int               // the number of times to send the response, if zero the response is sent until cleared
+}
+
+// SendGridError is an error in the body of a SendGrid error response.
+type SendGridError struct {
+	Message string  `json:"message"`
+	Field   *string `json:"field"`
+	Help    *string `json:"help"`
+}
+
+// The body of SendGrid error responses.
+type sendGridErrors struct {
+	Errors []SendGridError `json:"errors"`
+}
+
+// NewSendGridServer starts and returns a new SendGrid API server that accepts any API
+// key. The caller should call Close when finished to shut it down.
+func NewSendGridServer() *SendGridServer {
+	srv := &SendGridServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(srv.handle))
+	return srv
+}
+
+// Config returns a SendGrid configuration that sends requests to the server.
+func (s *SendGridServer) Config() commo.SendGridConfig {
+	apiKey := s.APIKey
+	if apiKey == "" {
+		apiKey = "SG.commotest"
+	}
+
+	return commo.SendGridConfig{
+		APIKey:  apiKey,
+		BaseURL: s.URL,
+	}
+}
+
+// Messages returns a copy of all of the messages the server has accepted in the order
+// that they were received in.
+func (s *SendGridServer) Messages() []*sgmail.SGMailV3 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*sgmail.SGMailV3, len(s.messages))
+	copy(out, s.messages)
+	return out
+}
+
+// Requests returns the number of mail send requests the server has received,
+// including requests that were rejected or answered with a scripted response.
+func (s *SendGridServer) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Reset removes all accepted messages and scripted responses from the server.
+func (s *SendGridServer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+	s.responses = nil
+	s.requests = 0
+}
+
+// Respond scripts the server to send the responses in order instead of handling
+// requests normally. A response is sent until its Times are exhausted and then the
+// next response is used; once all responses are used requests are handled normally.
+func (s *SendGridServer) Respond(responses ...SendGridResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rep := range responses {
+		s.responses = append(s.responses, &rep)
+	}
+}
+
+// ClearResponses removes all scripted responses so requests are handled normally.
+func (s *SendGridServer) ClearResponses() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = nil
+}
+
+// BadRequest returns a scripted 400 response with the specified error.
+func BadRequest(field, message string) SendGridResponse {
+	return SendGridResponse{
+		StatusCode: http.StatusBadRequest,
+		Errors:     []SendGridError{{Message: message, Field: &field}},
+		Times:      1,
+	}
+}
+
+// RateLimited returns a scripted 429 response with the SendGrid rate limit headers
+// set so that the limit resets after the specified duration.
+func RateLimited(reset time.Duration) SendGridResponse {
+	return SendGridResponse{
+		StatusCode: http.StatusTooManyRequests,
+		Errors:     []SendGridError{{Message: "too many requests"}},
+		Header: map[string]string{
+			"X-RateLimit-Limit":     "600",
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     strconv.FormatInt(time.Now().Add(reset).Unix(), 10),
+			"Retry-After":           strconv.Itoa(int(reset.Round(time.Second).Seconds())),
+		},
+		Times: 1,
+	}
+}
+
+// ServerError returns a scripted 5xx response with the specified status code.
+func ServerError(code int) SendGridResponse {
+	return SendGridResponse{
+		StatusCode: code,
+		Errors:     []SendGridError{{Message: http.StatusText(code)}},
+		Times:      1,
+	}
+}
+
+// Returns the next scripted response if there is one, decrementing the number of
+// times it should be sent and removing it when it is exhausted.
+func (s *SendGridServer) scripted() (rep SendGridResponse, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.responses) == 0 {
+		return SendGridResponse{}, false
+	}
+
+	next := s.responses[0]
+	if next.Times > 0 {
+		next.Times--
+		if next.Times == 0 {
+			s.responses = s.responses[1:]
+		}
+	}
+	return *next, true
+}
+
+func (s *SendGridServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != SendGridEndpoint {
+		writeSendGridErrors(w, http.StatusNotFound, nil, SendGridError{Message: "not found"})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeSendGridErrors(w, http.StatusMethodNotAllowed, nil, SendGridError{Message: "method not allowed"})
+		return
+	}
+
+	s.mu.Lock()
+	s.requests++
+	s.mu.Unlock()
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") || (s.APIKey != "" && auth != "Bearer "+s.APIKey) {
+		writeSendGridErrors(w, http.StatusUnauthorized, nil, SendGridError{Message: "The provided authorization grant is invalid, expired, or revoked"})
+		return
+	}
+
+	if rep, ok := s.scripted(); ok {
+		if rep.Delay > 0 {
+			select {
+			case <-time.After(rep.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		writeSendGridErrors(w, rep.StatusCode, rep.Header, rep.Errors...)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+	if err != nil {
+		writeSendGridErrors(w, http.StatusBadRequest, nil, SendGridError{Message: "could not read request body"})
+		return
+	}
+
+	if len(body) > maxMessageSize {
+		writeSendGridErrors(w, http.StatusRequestEntityTooLarge, nil, SendGridError{Message: "The JSON payload you have included in your request is too large."})
+		return
+	}
+
+	msg := &sgmail.SGMailV3{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(msg); err != nil {
+		writeSendGridErrors(w, http.StatusBadRequest, nil, SendGridError{Message: "Bad Request"})
+		return
+	}
+
+	if errs := ValidateSendGrid(msg); len(errs) > 0 {
+		writeSendGridErrors(w, http.StatusBadRequest, nil, errs...)
+		return
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, msg)
+	id := len(s.messages)
+	s.mu.Unlock()
+
+	w.Header().Set("X-Message-Id", fmt.Sprintf("commotest%08d", id))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func writeSendGridErrors(w http.ResponseWriter, code int, header map[string]string, errs ...SendGridError) {
+	for key, val := range header {
+		w.Header().Set(key, val)
+	}
+
+	if len(errs) == 0 {
+		w.WriteHeader(code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(sendGridErrors{Errors: errs})
+}
+
+// ValidateSendGrid checks a mail send request against the rules that the SendGrid v3
+// API enforces and returns the errors that SendGrid would return in a 400 response.
+func ValidateSendGrid(msg *sgmail.SGMailV3) (errs []SendGridError) {
+	invalid := func(field, message string) {
+		errs = append(errs, SendGridError{Message: message, Field: &field})
+	}
+
+	validEmail := func(field string, addr *sgmail.Email) {
+		if addr == nil || addr.Address == "" {
+			invalid(field, "The email address is required.")
+			return
+		}
+
+		if _, err := mail.ParseAddress(addr.Address); err != nil {
+			invalid(field, "Does not contain a valid address.")
+		}
+	}
+
+	validEmail("from.email", msg.From)
+
+	if msg.ReplyTo != nil {
+		validEmail("reply_to.email", msg.ReplyTo)
+	}
+
+	switch {
+	case len(msg.Personalizations) == 0:
+		invalid("personalizations", "The personalization block is required.")
+	case len(msg.Personalizations) > maxPersonalizations:
+		invalid("personalizations", "You may not have more than 1000 personalizations.")
+	}
+
+	for i, p := range msg.Personalizations {
+		prefix := fmt.Sprintf("personalizations.%d", i)
+		if len(p.To) == 0 {
+			invalid(prefix+".to", "The to array is required for all personalization objects, and must have at least one email object with a valid email address.")
+		}
+
+		if len(p.To)+len(p.CC)+len(p.BCC) > maxRecipients {
+			invalid(prefix, "The total number of recipients must be less than 1000.")
+		}
+
+		seen := make(map[string]struct{})
+		for field, addrs := range map[string][]*sgmail.Email{"to": p.To, "cc": p.CC, "bcc": p.BCC} {
+			for j, addr := range addrs {
+				validEmail(fmt.Sprintf("%s.%s.%d.email", prefix, field, j), addr)
+				if addr == nil {
+					continue
+				}
+
+				key := strings.ToLower(addr.Address)
+				if _, ok := seen[key]; ok {
+					invalid(prefix, "Each email address in the personalization block should be unique between to, cc, and bcc.")
+				}
+				seen[key] = struct{}{}
+			}
+		}
+
+		if msg.Subject == "" && p.Subject == "" && msg.TemplateID == "" {
+			invalid("subject", "The subject is required. You can get around this requirement if you use a template with a subject defined or if every personalization has a subject defined.")
+		}
+	}
+
+	if len(msg.Content) == 0 && msg.TemplateID == "" {
+		invalid("content", "Unless a valid template_id is provided, the content parameter is required. There must be at least one defined content block.")
+	}
+
+	for i, content := range msg.Content {
+		field := fmt.Sprintf("content.%d", i)
+		switch {
+		case content.Type == "":
+			invalid(field+".type", "The content type is required.")
+		case content.Value == "":
+			invalid(field+".value", "The content value must be a string at least one character in length.")
+		case content.Type == "text/plain" && i != 0:
+			invalid(field+".type", "If present, text/plain content must be first, followed by any other content.")
+		}
+	}
+
+	for i, attachment := range msg.Attachments {
+		field := fmt.Sprintf("attachments.%d", i)
+		if attachment.Filename == "" {
+			invalid(field+".filename", "The attachment filename parameter is required.")
+		}
+
+		if _, err := base64.StdEncoding.DecodeString(attachment.Content); err != nil || attachment.Content == "" {
+			invalid(field+".content", "The attachment content must be base64 encoded.")
+		}
+
+		if attachment.Disposition == "inline" && attachment.ContentID == "" {
+			invalid(field+".content_id", "The content_id parameter is required if the disposition is set to inline.")
+		}
+	}
+
+	for key := range msg.Headers {
+		switch strings.ToLower(key) {
+		case "x-sg-id", "x-sg-eid", "received", "dkim-signature", "content-type", "content-transfer-encoding", "to", "from", "subject", "reply-to", "cc", "bcc":
+			invalid("headers", fmt.Sprintf("The %s header is a reserved header and cannot be set.", key))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,153 @@
+package commotest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo/commotest"
+)
+
+func TestSendGridServer(t *testing.T) {
+	srv := commotest.NewSendGridServer()
+	srv.APIKey = "SG.testing"
+	t.Cleanup(srv.Close)
+
+	conf := srv.Config()
+	require.Equal(t, "SG.testing", conf.APIKey)
+	require.Equal(t, srv.URL, conf.BaseURL)
+
+	send := func(apiKey string, msg any) *http.Response {
+		body, err := json.Marshal(msg)
+		require.NoError(t, err, "could not marshal request")
+
+		req, err := http.NewRequest(http.MethodPost, srv.URL+commotest.SendGridEndpoint, bytes.NewReader(body))
+		require.NoError(t, err, "could not create request")
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Content-Type", "application/json")
+
+		rep, err := srv.Client().Do(req)
+		require.NoError(t, err, "could not make request")
+		t.Cleanup(func() { rep.Body.Close() })
+		return rep
+	}
+
+	errors := func(rep *http.Response) (out []string) {
+		body := struct{ Errors []commotest.SendGridError }{}
+		require.NoError(t, json.NewDecoder(rep.Body).Decode(&body), "could not decode error body")
+		for _, err := range body.Errors {
+			out = append(out, err.Message)
+		}
+		return out
+	}
+
+	valid := func() *sgmail.SGMailV3 {
+		msg := sgmail.NewV3MailInit(
+			sgmail.NewEmail("Jane Szack", "jane@example.com"),
+			"Hello",
+			sgmail.NewEmail("Tess Tester", "tess@example.com"),
+			sgmail.NewContent("text/plain", "Hi there!"),
+		)
+		msg.AddContent(sgmail.NewContent("text/html", "<p>Hi there!</p>"))
+		return msg
+	}
+
+	t.Run("Accepted", func(t *testing.T) {
+		srv.Reset()
+		rep := send("SG.testing", valid())
+		require.Equal(t, http.StatusAccepted, rep.StatusCode)
+		require.NotEmpty(t, rep.Header.Get("X-Message-Id"))
+
+		msgs := srv.Messages()
+		require.Len(t, msgs, 1)
+		require.Equal(t, "Hello", msgs[0].Subject)
+		require.Equal(t, "tess@example.com", msgs[0].Personalizations[0].To[0].Address)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		srv.Reset()
+		rep := send("SG.wrong", valid())
+		require.Equal(t, http.StatusUnauthorized, rep.StatusCode)
+		require.Empty(t, srv.Messages())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		srv.Reset()
+		msg := valid()
+		msg.Subject = ""
+		msg.Content = []*sgmail.Content{{Type: "text/html", Value: "<p>Hi</p>"}, {Type: "text/plain", Value: "Hi"}}
+		msg.Personalizations[0].AddCCs(sgmail.NewEmail("", "TESS@example.com"))
+
+		rep := send("SG.testing", msg)
+		require.Equal(t, http.StatusBadRequest, rep.StatusCode)
+		require.Len(t, errors(rep), 3)
+		require.Empty(t, srv.Messages())
+	})
+
+	t.Run("Scripted", func(t *testing.T) {
+		srv.Reset()
+		srv.Respond(
+			commotest.RateLimited(2*time.Second),
+			commotest.ServerError(http.StatusBadGateway),
+		)
+
+		rep := send("SG.testing", valid())
+		require.Equal(t, http.StatusTooManyRequests, rep.StatusCode)
+		require.Equal(t, "0", rep.Header.Get("X-RateLimit-Remaining"))
+		require.Equal(t, "2", rep.Header.Get("Retry-After"))
+		require.NotEmpty(t, rep.Header.Get("X-RateLimit-Reset"))
+
+		rep = send("SG.testing", valid())
+		require.Equal(t, http.StatusBadGateway, rep.StatusCode)
+		require.Equal(t, []string{"Bad Gateway"}, errors(rep))
+
+		rep = send("SG.testing", valid())
+		require.Equal(t, http.StatusAccepted, rep.StatusCode)
+		require.Equal(t, 3, srv.Requests())
+		require.Len(t, srv.Messages(), 1)
+	})
+}
+
+func TestValidateSendGrid(t *testing.T) {
+	testCases := []struct {
+		msg  *sgmail.SGMailV3
+		errs int
+	}{
+		{
+			sgmail.NewV3MailInit(
+				sgmail.NewEmail("", "jane@example.com"), "Hello",
+				sgmail.NewEmail("", "tess@example.com"), sgmail.NewContent("text/plain", "Hi"),
+			),
+			0,
+		},
+		{
+			&sgmail.SGMailV3{},
+			3,
+		},
+		{
+			sgmail.NewV3MailInit(
+				sgmail.NewEmail("", "jane@@example"), "Hello",
+				sgmail.NewEmail("", "tess@example.com"), sgmail.NewContent("text/plain", ""),
+			),
+			2,
+		},
+		{
+			&sgmail.SGMailV3{
+				From:             sgmail.NewEmail("", "jane@example.com"),
+				TemplateID:       "d-1234",
+				Personalizations: []*sgmail.Personalization{{To: []*sgmail.Email{sgmail.NewEmail("", "tess@example.com")}}},
+				Attachments:      []*sgmail.Attachment{{Filename: "logo.png", Content: "not base64!", Disposition: "inline"}},
+				Headers:          map[string]string{"Subject": "Overridden"},
+			},
+			3,
+		},
+	}
+
+	for i, tc := range testCases {
+		require.Len(t, commotest.ValidateSendGrid(tc.msg), tc.errs, "test case %d failed", i)
+	}
+}
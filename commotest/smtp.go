@@ -0,0 +1,579 @@
+package commotest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.rtnl.ai/commo"
+)
+
+// SMTPServer is an in-process SMTP server listening on a loopback port that stores
+// the messages it receives. It supports EHLO, AUTH PLAIN, AUTH CRAM-MD5, and STARTTLS
+// and replies to commands can be scripted to test temporary and permanent failures.
+//
+// The server is modeled after [httptest.Server]: use NewSMTPServer to create a
+// started server that does not require authentication, or NewUnstartedSMTPServer to
+// set credentials before calling Start or StartTLS.
+type SMTPServer struct {
+	Listener net.Listener
+	Hostname string // the name of the server sent in the greeting and EHLO replies
+	Username string // if set, clients must authenticate before sending mail
+	Password string
+
+	mu        sync.Mutex
+	tls       *tls.Config
+	cert      *x509.Certificate
+	messages  []*Message
+	replies   map[string]*Reply
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+	closed    bool
+	startOnce sync.Once
+}
+
+// Reply is a scripted response to an SMTP command that the server sends instead of
+// handling the command normally.
+type Reply struct {
+	Code    int    // the SMTP reply code, e.g. 421 or 550
+	Message string // the reply text, including an enhanced status code if desired
+	Times   int    // the number of times to send the reply, if zero the reply is sent until cleared
+}
+
+// Commands that replies can be scripted for with SetReply in addition to the SMTP verbs.
+const (
+	// ReplyMessage is the reply sent after the message content is received.
+	ReplyMessage = "MESSAGE"
+)
+
+// NewSMTPServer starts and returns a new SMTP server that does not require
+// authentication. The caller should call Close when finished to shut it down.
+func NewSMTPServer() *SMTPServer {
+	srv := NewUnstartedSMTPServer()
+	srv.Start()
+	return srv
+}
+
+// NewUnstartedSMTPServer returns a new SMTP server listening on a loopback port but
+// that does not accept connections until Start or StartTLS is called.
+func NewUnstartedSMTPServer() *SMTPServer {
+	return &SMTPServer{
+		Listener: newLocalListener(),
+		Hostname: "localhost",
+		replies:  make(map[string]*Reply),
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+func newLocalListener() net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		if l, err = net.Listen("tcp6", "[::1]:0"); err != nil {
+			panic(fmt.Sprintf("commotest: failed to listen on a port: %v", err))
+		}
+	}
+	return l
+}
+
+// Start the server without STARTTLS support.
+func (s *SMTPServer) Start() {
+	s.startOnce.Do(func() {
+		s.wg.Add(1)
+		go s.serve()
+	})
+}
+
+// StartTLS starts the server with STARTTLS support using a self-signed certificate.
+// Use ClientTLSConfig to configure clients to trust the certificate.
+func (s *SMTPServer) StartTLS() {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		panic(fmt.Sprintf("commotest: could not create certificate: %v", err))
+	}
+
+	s.mu.Lock()
+	s.cert = cert.Leaf
+	s.tls = &tls.Config{Certificates: []tls.Certificate{cert}}
+	s.mu.Unlock()
+
+	s.Start()
+}
+
+// Close shuts down the server, closing all open client connections.
+func (s *SMTPServer) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+
+	s.closed = true
+	s.Listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// Addr returns the host:port address the server is listening on.
+func (s *SMTPServer) Addr() string {
+	return s.Listener.Addr().String()
+}
+
+// Host returns the host the server is listening on without the port.
+func (s *SMTPServer) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+	return host
+}
+
+// Port returns the port the server is listening on.
+func (s *SMTPServer) Port() uint16 {
+	_, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.ParseUint(port, 10, 16)
+	return uint16(p)
+}
+
+// Config returns an SMTP configuration that connects to the server with the server's
+// credentials and the client TLS configuration if the server was started with TLS.
+func (s *SMTPServer) Config() commo.SMTPConfig {
+	return commo.SMTPConfig{
+		Host:      s.Host(),
+		Port:      s.Port(),
+		Username:  s.Username,
+		Password:  s.Password,
+		PoolSize:  2,
+		TLSConfig: s.ClientTLSConfig(),
+	}
+}
+
+// Certificate returns the self-signed certificate used by the server for STARTTLS or
+// nil if the server was not started with TLS.
+func (s *SMTPServer) Certificate() *x509.Certificate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cert
+}
+
+// ClientTLSConfig returns a TLS configuration that trusts the certificate of the
+// server or nil if the server was not started with TLS.
+func (s *SMTPServer) ClientTLSConfig() *tls.Config {
+	cert := s.Certificate()
+	if cert == nil {
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{RootCAs: pool, ServerName: s.Host()}
+}
+
+// Messages returns a copy of all of the messages the server has received in the
+// order that they were received in.
+func (s *SMTPServer) Messages() []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*Message, len(s.messages))
+	copy(out, s.messages)
+	return out
+}
+
+// Reset removes all received messages and scripted replies from the server.
+func (s *SMTPServer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+	s.replies = make(map[string]*Reply)
+}
+
+// SetReply scripts the server to send the specified reply to the command instead of
+// handling it. The command is an SMTP verb such as MAIL, RCPT, or DATA or one of the
+// Reply constants such as ReplyMessage.
+func (s *SMTPServer) SetReply(command string, reply Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies[strings.ToUpper(command)] = &reply
+}
+
+// ClearReplies removes all scripted replies so that commands are handled normally.
+func (s *SMTPServer) ClearReplies() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = make(map[string]*Reply)
+}
+
+// Returns the scripted reply for the command if there is one, decrementing the
+// number of times it should be sent and removing it when it is exhausted.
+func (s *SMTPServer) scripted(command string) (reply Reply, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var r *Reply
+	if r, ok = s.replies[command]; !ok {
+		return Reply{}, false
+	}
+
+	if r.Times > 0 {
+		r.Times--
+		if r.Times == 0 {
+			delete(s.replies, command)
+		}
+	}
+	return *r, true
+}
+
+func (s *SMTPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			sess := &session{srv: s, conn: conn}
+			sess.handle()
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			sess.conn.Close()
+		}()
+	}
+}
+
+// Add a received message to the server's storage.
+func (s *SMTPServer) store(msg *Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+}
+
+func (s *SMTPServer) tlsConfig() *tls.Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tls
+}
+
+// The state of a single client connection to the server.
+type session struct {
+	srv    *SMTPServer
+	conn   net.Conn
+	text   *textproto.Conn
+	tls    bool
+	helo   bool
+	authed bool
+	from   string
+	rcpts  []string
+}
+
+var errQuit = errors.New("client quit")
+
+func (s *session) handle() {
+	s.text = textproto.NewConn(s.conn)
+	if err := s.reply(220, "%s ESMTP commotest ready", s.srv.Hostname); err != nil {
+		return
+	}
+
+	for {
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+
+		if reply, ok := s.srv.scripted(verb); ok {
+			if err = s.reply(reply.Code, "%s", reply.Message); err != nil {
+				return
+			}
+			continue
+		}
+
+		if err = s.command(verb, strings.TrimSpace(arg)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *session) command(verb, arg string) error {
+	switch verb {
+	case "HELO":
+		s.helo = true
+		return s.reply(250, "%s", s.srv.Hostname)
+	case "EHLO":
+		s.helo = true
+		return s.ehlo()
+	case "STARTTLS":
+		return s.starttls()
+	case "AUTH":
+		return s.auth(arg)
+	case "MAIL":
+		return s.mail(arg)
+	case "RCPT":
+		return s.rcpt(arg)
+	case "DATA":
+		return s.data()
+	case "RSET":
+		s.reset()
+		return s.reply(250, "2.0.0 OK")
+	case "NOOP":
+		return s.reply(250, "2.0.0 OK")
+	case "VRFY":
+		return s.reply(252, "2.5.0 Cannot VRFY user")
+	case "QUIT":
+		s.reply(221, "2.0.0 Bye")
+		return errQuit
+	default:
+		return s.reply(502, "5.5.2 Command not recognized")
+	}
+}
+
+func (s *session) ehlo() error {
+	lines := []string{s.srv.Hostname, "8BITMIME", "PIPELINING"}
+	if s.srv.tlsConfig() != nil && !s.tls {
+		lines = append(lines, "STARTTLS")
+	}
+	if s.srv.Username != "" {
+		lines = append(lines, "AUTH PLAIN CRAM-MD5")
+	}
+
+	for i, line := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		if err := s.text.PrintfLine("250%s%s", sep, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *session) starttls() (err error) {
+	conf := s.srv.tlsConfig()
+	if conf == nil || s.tls {
+		return s.reply(502, "5.5.1 STARTTLS not available")
+	}
+
+	if err = s.reply(220, "2.0.0 Ready to start TLS"); err != nil {
+		return err
+	}
+
+	conn := tls.Server(s.conn, conf)
+	if err = conn.Handshake(); err != nil {
+		return err
+	}
+
+	// The client must send EHLO and authenticate again after the TLS handshake.
+	s.conn = conn
+	s.text = textproto.NewConn(conn)
+	s.tls = true
+	s.helo = false
+	s.authed = false
+	s.reset()
+	return nil
+}
+
+func (s *session) auth(arg string) (err error) {
+	if s.srv.Username == "" {
+		return s.reply(502, "5.5.1 AUTH not available")
+	}
+
+	if s.authed {
+		return s.reply(503, "5.5.1 Already authenticated")
+	}
+
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var ok bool
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		ok, err = s.authPlain(initial)
+	case "CRAM-MD5":
+		ok, err = s.authCRAMMD5()
+	default:
+		return s.reply(504, "5.5.4 Unrecognized authentication type")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return s.reply(535, "5.7.8 Authentication credentials invalid")
+	}
+
+	s.authed = true
+	return s.reply(235, "2.7.0 Authentication successful")
+}
+
+func (s *session) authPlain(initial string) (_ bool, err error) {
+	if initial == "" {
+		if err = s.text.PrintfLine("334 "); err != nil {
+			return false, err
+		}
+
+		if initial, err = s.text.ReadLine(); err != nil {
+			return false, err
+		}
+	}
+
+	var resp []byte
+	if resp, err = base64.StdEncoding.DecodeString(initial); err != nil {
+		return false, nil
+	}
+
+	// The response is authzid\x00authcid\x00password
+	parts := bytes.Split(resp, []byte{0})
+	if len(parts) != 3 {
+		return false, nil
+	}
+	return string(parts[1]) == s.srv.Username && string(parts[2]) == s.srv.Password, nil
+}
+
+func (s *session) authCRAMMD5() (_ bool, err error) {
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	challenge := fmt.Sprintf("<%x.%d@%s>", nonce, time.Now().Unix(), s.srv.Hostname)
+
+	if err = s.text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge))); err != nil {
+		return false, err
+	}
+
+	var line string
+	if line, err = s.text.ReadLine(); err != nil {
+		return false, err
+	}
+
+	var resp []byte
+	if resp, err = base64.StdEncoding.DecodeString(line); err != nil {
+		return false, nil
+	}
+
+	// The response is the username and the hex encoded HMAC-MD5 of the challenge.
+	username, digest, _ := strings.Cut(string(resp), " ")
+	mac := hmac.New(md5.New, []byte(s.srv.Password))
+	mac.Write([]byte(challenge))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	return username == s.srv.Username && hmac.Equal([]byte(digest), []byte(expected)), nil
+}
+
+func (s *session) mail(arg string) error {
+	switch {
+	case !s.helo:
+		return s.reply(503, "5.5.1 Send EHLO first")
+	case s.srv.Username != "" && !s.authed:
+		return s.reply(530, "5.7.0 Authentication required")
+	case s.from != "":
+		return s.reply(503, "5.5.1 Sender already specified")
+	}
+
+	addr, ok := parsePath(arg, "FROM:")
+	if !ok {
+		return s.reply(501, "5.5.4 Syntax error in MAIL command")
+	}
+
+	s.from = addr
+	return s.reply(250, "2.1.0 OK")
+}
+
+func (s *session) rcpt(arg string) error {
+	if s.from == "" {
+		return s.reply(503, "5.5.1 Need MAIL before RCPT")
+	}
+
+	addr, ok := parsePath(arg, "TO:")
+	if !ok || addr == "" {
+		return s.reply(501, "5.5.4 Syntax error in RCPT command")
+	}
+
+	s.rcpts = append(s.rcpts, addr)
+	return s.reply(250, "2.1.5 OK")
+}
+
+func (s *session) data() (err error) {
+	if len(s.rcpts) == 0 {
+		return s.reply(503, "5.5.1 Need RCPT before DATA")
+	}
+
+	if err = s.reply(354, "End data with <CR><LF>.<CR><LF>"); err != nil {
+		return err
+	}
+
+	var raw []byte
+	if raw, err = io.ReadAll(s.text.DotReader()); err != nil {
+		return err
+	}
+
+	defer s.reset()
+	if reply, ok := s.srv.scripted(ReplyMessage); ok {
+		return s.reply(reply.Code, "%s", reply.Message)
+	}
+
+	var msg *Message
+	if msg, err = ParseMessage(raw); err != nil {
+		return s.reply(554, "5.6.0 Could not parse message: %s", err)
+	}
+
+	msg.From = s.from
+	msg.Recipients = s.rcpts
+	s.srv.store(msg)
+	return s.reply(250, "2.0.0 OK: queued")
+}
+
+func (s *session) reset() {
+	s.from = ""
+	s.rcpts = nil
+}
+
+func (s *session) reply(code int, format string, args ...any) error {
+	return s.text.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+// Parses the address from a MAIL FROM:<addr> or RCPT TO:<addr> argument, ignoring any
+// ESMTP parameters that follow the path.
+func parsePath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	path := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(path, "<") {
+		return "", false
+	}
+
+	end := strings.Index(path, ">")
+	if end < 0 {
+		return "", false
+	}
+	return path[1:end], true
+}
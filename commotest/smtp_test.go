@@ -0,0 +1,133 @@
+package commotest_test
+
+import (
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/jordan-wright/email"
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo/commotest"
+)
+
+func TestSMTPServer(t *testing.T) {
+	srv := commotest.NewUnstartedSMTPServer()
+	srv.Username = "jszack"
+	srv.Password = "supersecret"
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	require.Equal(t, "127.0.0.1", srv.Host())
+	require.NotZero(t, srv.Port())
+	require.NotNil(t, srv.Certificate())
+
+	t.Run("Session", func(t *testing.T) {
+		client, err := smtp.Dial(srv.Addr())
+		require.NoError(t, err, "could not connect to server")
+		defer client.Close()
+
+		ok, _ := client.Extension("STARTTLS")
+		require.True(t, ok, "expected STARTTLS to be advertised")
+
+		// Mail cannot be sent without authentication
+		require.ErrorContains(t, client.Mail("jane@example.com"), "Authentication required")
+
+		require.NoError(t, client.StartTLS(srv.ClientTLSConfig()), "could not start tls")
+		ok, _ = client.Extension("STARTTLS")
+		require.False(t, ok, "expected STARTTLS not to be advertised after tls")
+
+		err = client.Auth(smtp.PlainAuth("", "jszack", "supersecret", srv.Host()))
+		require.NoError(t, err, "could not authenticate")
+
+		require.NoError(t, client.Mail("jane@example.com"))
+		require.NoError(t, client.Rcpt("tess@example.com"))
+		require.NoError(t, client.Rcpt("hidden@example.com"))
+
+		w, err := client.Data()
+		require.NoError(t, err, "could not start data")
+		_, err = w.Write([]byte("From: jane@example.com\r\nTo: tess@example.com\r\nSubject: Hello\r\n\r\nHi there!\r\n"))
+		require.NoError(t, err, "could not write message")
+		require.NoError(t, w.Close(), "message not accepted")
+		require.NoError(t, client.Quit())
+
+		msgs := srv.Messages()
+		require.Len(t, msgs, 1)
+		require.Equal(t, "jane@example.com", msgs[0].From)
+		require.Equal(t, []string{"tess@example.com", "hidden@example.com"}, msgs[0].Recipients)
+		require.Equal(t, "Hello", msgs[0].Subject)
+		require.Equal(t, "Hi there!\n", msgs[0].Text)
+	})
+
+	t.Run("Auth", func(t *testing.T) {
+		testCases := []struct {
+			auth smtp.Auth
+			err  string
+		}{
+			{smtp.PlainAuth("", "jszack", "supersecret", srv.Host()), ""},
+			{smtp.PlainAuth("", "jszack", "wrongpassword", srv.Host()), "Authentication credentials invalid"},
+			{smtp.PlainAuth("", "admin", "supersecret", srv.Host()), "Authentication credentials invalid"},
+			{smtp.CRAMMD5Auth("jszack", "supersecret"), ""},
+			{smtp.CRAMMD5Auth("jszack", "wrongpassword"), "Authentication credentials invalid"},
+		}
+
+		for i, tc := range testCases {
+			client, err := smtp.Dial(srv.Addr())
+			require.NoError(t, err, "could not connect to server")
+			require.NoError(t, client.StartTLS(srv.ClientTLSConfig()), "could not start tls")
+
+			if tc.err == "" {
+				require.NoError(t, client.Auth(tc.auth), "test case %d failed", i)
+			} else {
+				require.ErrorContains(t, client.Auth(tc.auth), tc.err, "test case %d failed", i)
+			}
+			client.Close()
+		}
+	})
+
+	t.Run("ScriptedReplies", func(t *testing.T) {
+		srv.Reset()
+		srv.SetReply("rcpt", commotest.Reply{Code: 452, Message: "4.2.2 Mailbox full", Times: 1})
+
+		client, err := smtp.Dial(srv.Addr())
+		require.NoError(t, err, "could not connect to server")
+		defer client.Close()
+
+		require.NoError(t, client.StartTLS(srv.ClientTLSConfig()), "could not start tls")
+		require.NoError(t, client.Auth(smtp.PlainAuth("", "jszack", "supersecret", srv.Host())))
+		require.NoError(t, client.Mail("jane@example.com"))
+		require.ErrorContains(t, client.Rcpt("tess@example.com"), "4.2.2 Mailbox full")
+		require.NoError(t, client.Rcpt("tess@example.com"), "scripted reply should only be sent once")
+
+		srv.SetReply("DATA", commotest.Reply{Code: 554, Message: "5.3.4 Message too big"})
+		_, err = client.Data()
+		require.ErrorContains(t, err, "5.3.4 Message too big")
+
+		srv.ClearReplies()
+		require.NoError(t, client.Reset())
+	})
+}
+
+func TestParseMessage(t *testing.T) {
+	msg := email.NewEmail()
+	msg.From = "Jane Szack <jane@example.com>"
+	msg.To = []string{"tess@example.com"}
+	msg.Subject = "Ünïcode Subject"
+	msg.Text = []byte("This is the text part, with a long line that should be wrapped by the quoted printable encoder.")
+	msg.HTML = []byte("<p>This is the <strong>html</strong> part</p>")
+	_, err := msg.Attach(strings.NewReader("a,b,c\n1,2,3\n"), "export.csv", "text/csv")
+	require.NoError(t, err, "could not attach file")
+
+	raw, err := msg.Bytes()
+	require.NoError(t, err, "could not render message")
+
+	parsed, err := commotest.ParseMessage(raw)
+	require.NoError(t, err, "could not parse message")
+	require.Equal(t, "Ünïcode Subject", parsed.Subject)
+	require.Equal(t, string(msg.Text), parsed.Text)
+	require.Equal(t, string(msg.HTML), parsed.HTML)
+	require.Len(t, parsed.Attachments, 1)
+	require.Equal(t, "export.csv", parsed.Attachments[0].Filename)
+	require.Equal(t, "text/csv", parsed.Attachments[0].ContentType)
+	require.Equal(t, "attachment", parsed.Attachments[0].Disposition)
+	require.Equal(t, "a,b,c\n1,2,3\n", string(parsed.Attachments[0].Content))
+}
@@ -1,9 +1,13 @@
 package commo
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net/http"
 	"net/mail"
 	"net/smtp"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/jordan-wright/email"
@@ -12,12 +16,15 @@ import (
 
 // The emails config allows users to either send messages via SendGrid or via SMTP.
 type Config struct {
-	Sender     string         `split_words:"true" desc:"the email address that messages are sent from"`
-	SenderName string         `split_words:"true" desc:"the name of the sender, usually the name of the organization"`
-	Testing    bool           `split_words:"true" default:"false" desc:"set the emailer to testing mode to ensure no live emails are sent"`
-	SMTP       SMTPConfig     `split_words:"true"`
-	SendGrid   SendGridConfig `split_words:"false"`
-	Backoff    BackoffConfig  `split_words:"true"`
+	Sender         string         `split_words:"true" desc:"the email address that messages are sent from"`
+	SenderName     string         `split_words:"true" desc:"the name of the sender, usually the name of the organization"`
+	TemplateSender bool           `split_words:"true" default:"false" desc:"send from the sender block of a template rather than the configured sender"`
+	Testing        bool           `split_words:"true" default:"false" desc:"set the emailer to testing mode to ensure no live emails are sent"`
+	Strict         bool           `default:"false" desc:"fail to render templates that refer to keys missing from the data rather than rendering <no value>"`
+	SMTP           SMTPConfig     `split_words:"true"`
+	SendGrid       SendGridConfig `split_words:"false"`
+	Backoff        BackoffConfig  `split_words:"true"`
+	Queue          QueueConfig    `split_words:"true"`
 }
 
 // Configuration for sending emails via SMTP.
@@ -28,11 +35,16 @@ type SMTPConfig struct {
 	Password   string `required:"false" desc:"the password for authentication with the smtp server"`
 	UseCRAMMD5 bool   `env:"USE_CRAM_MD5" default:"false" desc:"use CRAM-MD5 auth as defined in RFC 2195 instead of simple authentication"`
 	PoolSize   int    `split_words:"true" default:"2" desc:"the smtp connection pool size to use for concurrent email sending"`
+
+	// Optional TLS configuration used for STARTTLS, e.g. to trust a private certificate
+	// authority. It cannot be set from the environment; if nil the system roots are used.
+	TLSConfig *tls.Config `ignored:"true"`
 }
 
 // Configuration for sending emails using SendGrid.
 type SendGridConfig struct {
-	APIKey string `split_words:"true" required:"false" desc:"set the sendgrid api key to use sendgrid as the email backend"`
+	APIKey  string `split_words:"true" required:"false" desc:"set the sendgrid api key to use sendgrid as the email backend"`
+	BaseURL string `split_words:"true" required:"false" desc:"the base url of the sendgrid api, e.g. to use a regional host or a local test server (default: https://api.sendgrid.com)"`
 }
 
 // Configuration for timeouts and retries when sending emails.
@@ -43,6 +55,12 @@ type BackoffConfig struct {
 	MaxElapsedTime  time.Duration `split_words:"true" default:"180s" desc:"the the overall maximum time to try to send emails (default: 180 seconds)"`
 }
 
+// Configuration for the asynchronous send queue.
+type QueueConfig struct {
+	Size    int `default:"1024" desc:"the maximum number of emails waiting to be sent before enqueueing blocks"`
+	Workers int `default:"0" desc:"the number of emails sent concurrently by the queue (default: the smtp pool size)"`
+}
+
 // Returns true if either SMTP is configured or SendGrid is.
 func (c Config) Available() bool {
 	return c.SMTP.Enabled() || c.SendGrid.Enabled()
@@ -89,6 +107,11 @@ func (c Config) Validate() (err error) {
 		return err
 	}
 
+	// Validate the queue configuration
+	if err = c.Queue.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -120,6 +143,9 @@ func (c SMTPConfig) Validate() (err error) {
 }
 
 func (c SMTPConfig) Pool() (*email.Pool, error) {
+	if c.TLSConfig != nil {
+		return email.NewPool(c.Addr(), c.PoolSize, c.Auth(), c.TLSConfig)
+	}
 	return email.NewPool(c.Addr(), c.PoolSize, c.Auth())
 }
 
@@ -143,11 +169,23 @@ func (c SendGridConfig) Validate() (err error) {
 	if !c.Enabled() {
 		return nil
 	}
+
+	if c.BaseURL != "" {
+		if u, perr := url.Parse(c.BaseURL); perr != nil || u.Scheme == "" || u.Host == "" {
+			return ErrConfigInvalidBaseURL
+		}
+	}
 	return nil
 }
 
 func (c SendGridConfig) Client() *sendgrid.Client {
-	return sendgrid.NewSendClient(c.APIKey)
+	if c.BaseURL == "" {
+		return sendgrid.NewSendClient(c.APIKey)
+	}
+
+	request := sendgrid.GetRequest(c.APIKey, sendGridEndpoint, strings.TrimSuffix(c.BaseURL, "/"))
+	request.Method = http.MethodPost
+	return &sendgrid.Client{Request: request}
 }
 
 func (c Config) GetSenderName() string {
@@ -164,6 +202,28 @@ func (c Config) GetSenderName() string {
 	return ""
 }
 
+// Returns the backoff configuration with the defaults of the environment applied to
+// any durations that are not set, e.g. when the configuration is created in code, so
+// that a mailer never retries without a delay or a limit.
+func (c BackoffConfig) withDefaults() BackoffConfig {
+	if c.Timeout == 0 {
+		c.Timeout = 30 * time.Second
+	}
+
+	if c.InitialInterval == 0 {
+		c.InitialInterval = 3 * time.Second
+	}
+
+	if c.MaxInterval == 0 {
+		c.MaxInterval = 45 * time.Second
+	}
+
+	if c.MaxElapsedTime == 0 {
+		c.MaxElapsedTime = 180 * time.Second
+	}
+	return c
+}
+
 func (c BackoffConfig) Validate() (err error) {
 	if c.Timeout <= 0 {
 		return ErrConfigTimeout
@@ -183,3 +243,15 @@ func (c BackoffConfig) Validate() (err error) {
 
 	return nil
 }
+
+func (c QueueConfig) Validate() (err error) {
+	if c.Size < 0 {
+		return ErrConfigQueueSize
+	}
+
+	if c.Workers < 0 {
+		return ErrConfigQueueWorkers
+	}
+
+	return nil
+}
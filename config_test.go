@@ -13,7 +13,9 @@ import (
 var testEnv = map[string]string{
 	"EMAIL_SENDER":                   "Jane Szack <jane@example.com>",
 	"EMAIL_SENDER_NAME":              "Jane Szack",
+	"EMAIL_TEMPLATE_SENDER":          "true",
 	"EMAIL_TESTING":                  "true",
+	"EMAIL_STRICT":                   "true",
 	"EMAIL_SMTP_HOST":                "smtp.example.com",
 	"EMAIL_SMTP_PORT":                "25",
 	"EMAIL_SMTP_USERNAME":            "jszack",
@@ -21,10 +23,13 @@ var testEnv = map[string]string{
 	"EMAIL_SMTP_USE_CRAM_MD5":        "true",
 	"EMAIL_SMTP_POOL_SIZE":           "16",
 	"EMAIL_SENDGRID_API_KEY":         "sg:fakeapikey",
+	"EMAIL_SENDGRID_BASE_URL":        "https://api.eu.sendgrid.com",
 	"EMAIL_BACKOFF_TIMEOUT":          "1s",
 	"EMAIL_BACKOFF_INITIAL_INTERVAL": "1s",
 	"EMAIL_BACKOFF_MAX_INTERVAL":     "1s",
 	"EMAIL_BACKOFF_MAX_ELAPSED_TIME": "1s",
+	"EMAIL_QUEUE_SIZE":               "64",
+	"EMAIL_QUEUE_WORKERS":            "4",
 }
 
 func TestConfig(t *testing.T) {
@@ -36,7 +41,9 @@ func TestConfig(t *testing.T) {
 	conf, err := config()
 	require.Equal(t, testEnv["EMAIL_SENDER"], conf.Sender)
 	require.Equal(t, testEnv["EMAIL_SENDER_NAME"], conf.SenderName)
+	require.True(t, conf.TemplateSender)
 	require.True(t, conf.Testing)
+	require.True(t, conf.Strict)
 	require.Equal(t, testEnv["EMAIL_SMTP_HOST"], conf.SMTP.Host)
 	require.Equal(t, uint16(25), conf.SMTP.Port)
 	require.Equal(t, testEnv["EMAIL_SMTP_USERNAME"], conf.SMTP.Username)
@@ -44,6 +51,7 @@ func TestConfig(t *testing.T) {
 	require.True(t, conf.SMTP.UseCRAMMD5)
 	require.Equal(t, 16, conf.SMTP.PoolSize)
 	require.Equal(t, testEnv["EMAIL_SENDGRID_API_KEY"], conf.SendGrid.APIKey)
+	require.Equal(t, testEnv["EMAIL_SENDGRID_BASE_URL"], conf.SendGrid.BaseURL)
 	require.NoError(t, err, "could not process configuration from the environment")
 	dur, err := time.ParseDuration(testEnv["EMAIL_BACKOFF_TIMEOUT"])
 	require.NoError(t, err)
@@ -57,6 +65,8 @@ func TestConfig(t *testing.T) {
 	dur, err = time.ParseDuration(testEnv["EMAIL_BACKOFF_MAX_ELAPSED_TIME"])
 	require.NoError(t, err)
 	require.Equal(t, dur, conf.Backoff.MaxElapsedTime)
+	require.Equal(t, 64, conf.Queue.Size)
+	require.Equal(t, 4, conf.Queue.Workers)
 }
 
 func TestConfigAvailable(t *testing.T) {
@@ -312,6 +322,42 @@ func TestConfigValidation(t *testing.T) {
 				},
 				commo.ErrConfigTimeout,
 			},
+			{
+				commo.Config{
+					Sender:  "peony@example.com",
+					Testing: false,
+					SendGrid: commo.SendGridConfig{
+						APIKey:  "sg:fakeapikey",
+						BaseURL: "api.sendgrid.com",
+					},
+					Backoff: validBackoff,
+				},
+				commo.ErrConfigInvalidBaseURL,
+			},
+			{
+				commo.Config{
+					Sender:  "peony@example.com",
+					Testing: false,
+					SendGrid: commo.SendGridConfig{
+						APIKey: "sg:fakeapikey",
+					},
+					Backoff: validBackoff,
+					Queue:   commo.QueueConfig{Size: -1},
+				},
+				commo.ErrConfigQueueSize,
+			},
+			{
+				commo.Config{
+					Sender:  "peony@example.com",
+					Testing: false,
+					SendGrid: commo.SendGridConfig{
+						APIKey: "sg:fakeapikey",
+					},
+					Backoff: validBackoff,
+					Queue:   commo.QueueConfig{Workers: -1},
+				},
+				commo.ErrConfigQueueWorkers,
+			},
 		}
 
 		for i, tc := range testCases {
@@ -0,0 +1,622 @@
+package commo
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// InlineCSS moves the rules of the style blocks in a rendered html email into the style
+// attributes of the elements that they match, since many email clients strip style
+// blocks. Rules that cannot be inlined are kept in the head: at-rules such as media
+// queries, rules with pseudo classes such as :hover, rules with sibling combinators,
+// the universal selector, and rules that do not match any element (e.g. rules for
+// client specific elements).
+// Existing style attributes take precedence over inlined rules unless the rule is
+// marked !important. Comments, including MSO conditional comments, are left alone.
+func InlineCSS(src []byte) (_ []byte, err error) {
+	var doc *html.Node
+	if doc, err = html.Parse(bytes.NewReader(src)); err != nil {
+		return nil, err
+	}
+
+	var (
+		order  int
+		styles []*html.Node
+		inline = make(map[*html.Node][]matchedRule)
+	)
+
+	for _, style := range findAll(doc, atom.Style) {
+		var keep []string
+		for _, rule := range parseStylesheet(textContent(style)) {
+			if rule.selectors == "" {
+				keep = append(keep, rule.raw)
+				continue
+			}
+
+			var unmatched []string
+			for _, raw := range splitOutside(rule.selectors, ',') {
+				sel, ok := parseSelector(raw)
+				if !ok {
+					unmatched = append(unmatched, strings.TrimSpace(raw))
+					continue
+				}
+
+				matches := matchAll(doc, sel)
+				if len(matches) == 0 {
+					unmatched = append(unmatched, strings.TrimSpace(raw))
+					continue
+				}
+
+				for _, n := range matches {
+					inline[n] = append(inline[n], matchedRule{specificity: sel.specificity(), order: order, decls: rule.decls})
+				}
+				order++
+			}
+
+			if len(unmatched) > 0 {
+				keep = append(keep, strings.Join(unmatched, ", ")+" {"+rule.body+"}")
+			}
+		}
+
+		setText(style, strings.Join(keep, "\n"))
+		if len(keep) == 0 {
+			styles = append(styles, style)
+		}
+	}
+
+	for n, rules := range inline {
+		setAttr(n, "style", mergeStyles(rules, attr(n, "style")))
+	}
+
+	// Remove the style blocks whose rules have all been inlined.
+	for _, style := range styles {
+		style.Parent.RemoveChild(style)
+	}
+
+	buf := &bytes.Buffer{}
+	if err = html.Render(buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// A rule of a stylesheet; at-rules have no selectors and are kept as is.
+type cssRule struct {
+	selectors string
+	body      string
+	decls     []cssDecl
+	raw       string
+}
+
+type cssDecl struct {
+	property  string
+	value     string
+	important bool
+}
+
+type matchedRule struct {
+	specificity [3]int
+	order       int
+	decls       []cssDecl
+}
+
+// Parse the top level rules of a stylesheet.
+func parseStylesheet(css string) (rules []cssRule) {
+	css = stripComments(css)
+	for {
+		css = strings.TrimSpace(css)
+		if css == "" {
+			return rules
+		}
+
+		// At-rules without a block, e.g. @import or @charset, end at a semicolon.
+		open := indexOutside(css, '{')
+		if css[0] == '@' {
+			if semi := indexOutside(css, ';'); semi >= 0 && (open < 0 || semi < open) {
+				rules = append(rules, cssRule{raw: css[:semi+1]})
+				css = css[semi+1:]
+				continue
+			}
+		}
+
+		if open < 0 {
+			return rules
+		}
+
+		end := matchingBrace(css, open)
+		if end < 0 {
+			end = len(css) - 1
+		}
+
+		prelude := strings.TrimSpace(css[:open])
+		body := css[open+1 : end]
+		if strings.HasPrefix(prelude, "@") {
+			rules = append(rules, cssRule{raw: css[:end+1]})
+		} else {
+			rules = append(rules, cssRule{selectors: prelude, body: body, decls: parseDeclarations(body)})
+		}
+		css = css[end+1:]
+	}
+}
+
+// Parse the declarations of a rule body or a style attribute.
+func parseDeclarations(body string) (decls []cssDecl) {
+	for _, decl := range splitOutside(body, ';') {
+		colon := strings.IndexByte(decl, ':')
+		if colon < 0 {
+			continue
+		}
+
+		prop := strings.ToLower(strings.TrimSpace(decl[:colon]))
+		value := strings.TrimSpace(decl[colon+1:])
+		if prop == "" || value == "" {
+			continue
+		}
+
+		important := false
+		if i := strings.LastIndex(strings.ToLower(value), "!important"); i >= 0 {
+			important = true
+			value = strings.TrimSpace(value[:i])
+		}
+		decls = append(decls, cssDecl{property: prop, value: value, important: important})
+	}
+	return decls
+}
+
+// Merge the matched rules in order of specificity with the existing style attribute.
+func mergeStyles(rules []matchedRule, existing string) string {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].specificity != rules[j].specificity {
+			a, b := rules[i].specificity, rules[j].specificity
+			for k := range a {
+				if a[k] != b[k] {
+					return a[k] < b[k]
+				}
+			}
+		}
+		return rules[i].order < rules[j].order
+	})
+
+	var (
+		props  []string
+		values = make(map[string]cssDecl)
+	)
+
+	// Later declarations override earlier ones unless the earlier one is important.
+	apply := func(decl cssDecl) {
+		prev, ok := values[decl.property]
+		if !ok {
+			props = append(props, decl.property)
+		} else if prev.important && !decl.important {
+			return
+		}
+		values[decl.property] = decl
+	}
+
+	for _, rule := range rules {
+		for _, decl := range rule.decls {
+			apply(decl)
+		}
+	}
+
+	// The existing style attribute takes precedence over non-important rules.
+	for _, decl := range parseDeclarations(existing) {
+		apply(decl)
+	}
+
+	if len(props) == 0 {
+		return existing
+	}
+
+	out := make([]string, 0, len(props))
+	for _, prop := range props {
+		decl := values[prop]
+		if decl.important {
+			out = append(out, decl.property+": "+decl.value+" !important")
+		} else {
+			out = append(out, decl.property+": "+decl.value)
+		}
+	}
+	return strings.Join(out, "; ") + ";"
+}
+
+// A selector is a list of compound selectors joined by descendant (' ') or child
+// ('>') combinators, stored from left to right.
+type selector struct {
+	compounds   []compound
+	combinators []byte // combinators[i] joins compounds[i] and compounds[i+1]
+}
+
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+}
+
+type attrSelector struct {
+	key   string
+	op    string
+	value string
+}
+
+// Parse a selector, returning false if it uses features that cannot be inlined such as
+// pseudo classes, pseudo elements, or sibling combinators.
+func parseSelector(s string) (sel selector, ok bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return sel, false
+	}
+
+	var comb byte
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if comb == 0 && len(sel.compounds) > 0 {
+				comb = ' '
+			}
+			i++
+			continue
+		case c == '>':
+			if len(sel.compounds) == 0 {
+				return sel, false
+			}
+			comb = '>'
+			i++
+			continue
+		case c == '+' || c == '~' || c == ':' || c == ',':
+			return sel, false
+		}
+
+		var (
+			cmp compound
+			n   int
+		)
+		if cmp, n, ok = parseCompound(s[i:]); !ok {
+			return sel, false
+		}
+
+		if len(sel.compounds) > 0 {
+			sel.combinators = append(sel.combinators, comb)
+		}
+		sel.compounds = append(sel.compounds, cmp)
+		comb = 0
+		i += n
+	}
+
+	// The universal selector is kept in the head rather than added to every element.
+	if len(sel.compounds) == 1 && sel.compounds[0].universal() {
+		return sel, false
+	}
+	return sel, len(sel.compounds) > 0 && comb == 0
+}
+
+func (c compound) universal() bool {
+	return c.tag == "" && c.id == "" && len(c.classes) == 0 && len(c.attrs) == 0
+}
+
+func parseCompound(s string) (cmp compound, n int, ok bool) {
+	ident := func(start int) int {
+		end := start
+		for end < len(s) && isIdent(s[end]) {
+			end++
+		}
+		return end
+	}
+
+	if n < len(s) && s[n] == '*' {
+		n++
+	} else if end := ident(n); end > n {
+		cmp.tag = strings.ToLower(s[n:end])
+		n = end
+	}
+
+	for n < len(s) {
+		switch s[n] {
+		case '.', '#':
+			end := ident(n + 1)
+			if end == n+1 {
+				return cmp, n, false
+			}
+
+			if s[n] == '.' {
+				cmp.classes = append(cmp.classes, s[n+1:end])
+			} else {
+				cmp.id = s[n+1 : end]
+			}
+			n = end
+		case '[':
+			end := strings.IndexByte(s[n:], ']')
+			if end < 0 {
+				return cmp, n, false
+			}
+
+			var as attrSelector
+			if as, ok = parseAttrSelector(s[n+1 : n+end]); !ok {
+				return cmp, n, false
+			}
+			cmp.attrs = append(cmp.attrs, as)
+			n += end + 1
+		case ' ', '\t', '\n', '\r', '>':
+			return cmp, n, n > 0
+		default:
+			return cmp, n, false
+		}
+	}
+	return cmp, n, n > 0
+}
+
+func parseAttrSelector(s string) (as attrSelector, ok bool) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		as.key = strings.ToLower(strings.TrimSpace(s))
+		return as, as.key != ""
+	}
+
+	key := s[:i]
+	as.op = "="
+	if i > 0 && strings.IndexByte("~^$*|", s[i-1]) >= 0 {
+		as.op = s[i-1 : i+1]
+		key = s[:i-1]
+	}
+
+	as.key = strings.ToLower(strings.TrimSpace(key))
+	as.value = strings.Trim(strings.TrimSpace(s[i+1:]), `"'`)
+	return as, as.key != ""
+}
+
+// Specificity is the number of ids, the number of classes and attributes, and the
+// number of types in the selector.
+func (s selector) specificity() (spec [3]int) {
+	for _, cmp := range s.compounds {
+		if cmp.id != "" {
+			spec[0]++
+		}
+		spec[1] += len(cmp.classes) + len(cmp.attrs)
+		if cmp.tag != "" {
+			spec[2]++
+		}
+	}
+	return spec
+}
+
+// Returns all of the elements in the body of the document that match the selector.
+func matchAll(doc *html.Node, sel selector) (out []*html.Node) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Head {
+			return
+		}
+
+		if n.Type == html.ElementNode && sel.match(n) {
+			out = append(out, n)
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+
+	walk(doc)
+	return out
+}
+
+// Match the selector from right to left against the element and its ancestors.
+func (s selector) match(n *html.Node) bool {
+	return s.matchAt(n, len(s.compounds)-1)
+}
+
+func (s selector) matchAt(n *html.Node, i int) bool {
+	if !s.compounds[i].match(n) {
+		return false
+	}
+
+	if i == 0 {
+		return true
+	}
+
+	switch s.combinators[i-1] {
+	case '>':
+		return isElement(n.Parent) && s.matchAt(n.Parent, i-1)
+	default:
+		for p := n.Parent; isElement(p); p = p.Parent {
+			if s.matchAt(p, i-1) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c compound) match(n *html.Node) bool {
+	if c.tag != "" && c.tag != n.Data {
+		return false
+	}
+
+	if c.id != "" && attr(n, "id") != c.id {
+		return false
+	}
+
+	classes := strings.Fields(attr(n, "class"))
+	for _, class := range c.classes {
+		if !containsString(classes, class) {
+			return false
+		}
+	}
+
+	for _, a := range c.attrs {
+		if !hasAttr(n, a.key) {
+			return false
+		}
+
+		val := attr(n, a.key)
+		switch a.op {
+		case "":
+		case "=":
+			if val != a.value {
+				return false
+			}
+		case "~=":
+			if !containsString(strings.Fields(val), a.value) {
+				return false
+			}
+		case "^=":
+			if a.value == "" || !strings.HasPrefix(val, a.value) {
+				return false
+			}
+		case "$=":
+			if a.value == "" || !strings.HasSuffix(val, a.value) {
+				return false
+			}
+		case "*=":
+			if a.value == "" || !strings.Contains(val, a.value) {
+				return false
+			}
+		case "|=":
+			if val != a.value && !strings.HasPrefix(val, a.value+"-") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isElement(n *html.Node) bool {
+	return n != nil && n.Type == html.ElementNode
+}
+
+func isIdent(c byte) bool {
+	return c == '-' || c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func findAll(n *html.Node, a atom.Atom) (out []*html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == a {
+			out = append(out, c)
+			continue
+		}
+		out = append(out, findAll(c, a)...)
+	}
+	return out
+}
+
+// Returns the raw text content of an element such as a style block.
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+	}
+	return sb.String()
+}
+
+func setText(n *html.Node, s string) {
+	for n.FirstChild != nil {
+		n.RemoveChild(n.FirstChild)
+	}
+	n.AppendChild(&html.Node{Type: html.TextNode, Data: "\n" + s + "\n"})
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func stripComments(css string) string {
+	var sb strings.Builder
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			sb.WriteString(css)
+			return sb.String()
+		}
+
+		sb.WriteString(css[:start])
+		end := strings.Index(css[start+2:], "*/")
+		if end < 0 {
+			return sb.String()
+		}
+		css = css[start+2+end+2:]
+	}
+}
+
+// Returns the index of the closing brace that matches the opening brace at open.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Returns the index of the first sep that is not in quotes, parentheses, or brackets.
+func indexOutside(s string, sep byte) int {
+	var (
+		quote byte
+		depth int
+	)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// Split the string on sep where it is not in quotes, parentheses, or brackets.
+func splitOutside(s string, sep byte) (parts []string) {
+	for {
+		i := indexOutside(s, sep)
+		if i < 0 {
+			if strings.TrimSpace(s) != "" {
+				parts = append(parts, s)
+			}
+			return parts
+		}
+
+		if strings.TrimSpace(s[:i]) != "" {
+			parts = append(parts, s[:i])
+		}
+		s = s[i+1:]
+	}
+}
@@ -0,0 +1,84 @@
+package commo_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+func TestInlineCSS(t *testing.T) {
+	testCases := []struct {
+		html     string
+		expected string
+	}{
+		{
+			`<style>p { color: red; }</style><p>Hello</p>`,
+			`<html><head></head><body><p style="color: red;">Hello</p></body></html>`,
+		},
+		{
+			`<style>p { color: red; font-size: 14px } .lead { font-size: 18px; } #intro { color: blue }</style><p id="intro" class="lead">Hello</p><p>World</p>`,
+			`<html><head></head><body><p id="intro" class="lead" style="color: blue; font-size: 18px;">Hello</p><p style="color: red; font-size: 14px;">World</p></body></html>`,
+		},
+		{
+			`<style>p { color: red !important; margin: 0; }</style><p style="color: blue; margin: 4px">Hello</p>`,
+			`<html><head></head><body><p style="color: red !important; margin: 4px;">Hello</p></body></html>`,
+		},
+		{
+			`<style>td > p, div p.note { color: red; } table p { margin: 0; }</style><table><tr><td><p>A</p></td></tr></table><div><span><p class="note">B</p></span></div>`,
+			`<html><head></head><body><table><tbody><tr><td><p style="color: red; margin: 0;">A</p></td></tr></tbody></table><div><span><p class="note" style="color: red;">B</p></span></div></body></html>`,
+		},
+		{
+			`<style>a[href^="https"] { color: green; } a[target] { font-weight: bold; } img[alt="Logo"] { border: 0; }</style><a href="https://example.com" target="_blank">A</a><a href="mailto:a@example.com">B</a><img alt="Logo" src="logo.png">`,
+			`<html><head></head><body><a href="https://example.com" target="_blank" style="color: green; font-weight: bold;">A</a><a href="mailto:a@example.com">B</a><img alt="Logo" src="logo.png" style="border: 0;"/></body></html>`,
+		},
+		{
+			`<style>a:hover { color: red; } a, .missing { color: blue; } * { margin: 0; } @media (max-width: 480px) { a { color: green; } }</style><a href="#">A</a>`,
+			"<html><head><style>\na:hover { color: red; }\n.missing { color: blue; }\n* { margin: 0; }\n@media (max-width: 480px) { a { color: green; } }\n</style></head><body><a href=\"#\" style=\"color: blue;\">A</a></body></html>",
+		},
+		{
+			`<html><head><style>p { background: url("data:image/png;base64,abc"); }</style></head><body><!--[if mso]><table><tr><td><![endif]--><p>Hello</p><!--[if mso]></td></tr></table><![endif]--></body></html>`,
+			`<html><head></head><body><!--[if mso]><table><tr><td><![endif]--><p style="background: url(&#34;data:image/png;base64,abc&#34;);">Hello</p><!--[if mso]></td></tr></table><![endif]--></body></html>`,
+		},
+	}
+
+	for i, tc := range testCases {
+		html, err := commo.InlineCSS([]byte(tc.html))
+		require.NoError(t, err, "test case %d errored", i)
+		require.Equal(t, tc.expected, string(html), "test case %d failed", i)
+	}
+}
+
+func TestRenderInlineCSS(t *testing.T) {
+	layout := commo.Layout{Dir: "testdata/templates", InlineCSS: true}
+	templates, err := commo.LoadTemplates(files, layout)
+	require.NoError(t, err, "could not load templates")
+
+	mailer, err := commo.NewMailer(commo.Config{}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	_, html, err := mailer.RenderString("test_email", nil)
+	require.NoError(t, err, "could not render test_email")
+	require.Contains(t, html, `style="-ms-interpolation-mode: bicubic; height: auto;`, "expected img rule to be inlined")
+	require.Contains(t, html, `<p style="margin: 0 0 16px;">`, "expected existing styles to be preserved")
+	require.Contains(t, html, "@media (prefers-color-scheme: dark)", "expected media queries to be kept in the head")
+	require.Contains(t, html, "td.button-td-primary:hover", "expected hover rules to be kept in the head")
+	require.Equal(t, 2, strings.Count(html, "<style>"))
+
+	// The inlined html is still used to generate text.
+	fsys := fstest.MapFS{
+		"hidden.html": {Data: []byte(`<style>.hidden { display: none; }</style><p class="hidden">Preheader</p><p>Visible</p>`)},
+	}
+
+	templates, err = commo.LoadTemplates(fsys, commo.Layout{GenerateText: true, InlineCSS: true})
+	require.NoError(t, err, "could not load templates")
+
+	mailer, err = commo.NewMailer(commo.Config{}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	text, _, err := mailer.RenderString("hidden", nil)
+	require.NoError(t, err, "could not render hidden")
+	require.Equal(t, "Visible\n", text)
+}
@@ -0,0 +1,169 @@
+package commo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jordan-wright/email"
+	"github.com/sendgrid/rest"
+	"go.rtnl.ai/x/backoff"
+)
+
+// DeliveryError is returned when the email provider rejects an email or fails to
+// deliver it, e.g. an SMTP 550 reply or a SendGrid 400 response. Use errors.As to
+// inspect the status of the provider, e.g. to handle bad addresses differently from
+// outages. Errors that are not retryable are not retried by Send.
+type DeliveryError struct {
+	Backend      string // the name of the backend, e.g. smtp or sendgrid
+	StatusCode   int    // the SMTP reply code (e.g. 550) or the HTTP status code (e.g. 400)
+	EnhancedCode string // the SMTP enhanced status code if the server sent one, e.g. 5.1.1
+	Body         string // the SMTP reply message or the HTTP response body
+	Retryable    bool   // true if the delivery may succeed if it is attempted again
+	Err          error  // the underlying error, if any
+
+	// The minimum time to wait before the delivery is attempted again, e.g. from the
+	// Retry-After header of a rate limited response; zero if the provider did not say.
+	RetryAfter time.Duration
+}
+
+func (e *DeliveryError) Error() string {
+	body := strings.TrimSpace(e.Body)
+	if body == "" && e.Err != nil {
+		body = e.Err.Error()
+	}
+	return fmt.Sprintf("%s delivery failed with status %d: %s", e.Backend, e.StatusCode, body)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// BadRecipient returns true if the provider rejected a recipient address of the email,
+// e.g. because the mailbox does not exist (SMTP enhanced status code 5.1.1). Such errors
+// will not succeed if retried, so the address should be corrected or suppressed.
+func (e *DeliveryError) BadRecipient() bool {
+	if e.EnhancedCode != "" {
+		// Enhanced status codes with subject 1 are addressing errors (RFC 3463).
+		return strings.HasPrefix(e.EnhancedCode, "5.1.")
+	}
+
+	// Without an enhanced code, the SMTP replies for an unknown or invalid mailbox.
+	switch e.StatusCode {
+	case 550, 551, 553:
+		return e.Backend == "smtp"
+	default:
+		return false
+	}
+}
+
+var enhancedCode = regexp.MustCompile(`^([245]\.\d{1,3}\.\d{1,3})\b`)
+
+// Classifies an SMTP error; replies with a 4xx code are transient and replies with a
+// 5xx code are permanent. Errors without a reply (e.g. network errors) are retryable,
+// except when the pool has been closed.
+func newSMTPError(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		derr := &DeliveryError{
+			Backend:    "smtp",
+			StatusCode: reply.Code,
+			Body:       reply.Msg,
+			Retryable:  reply.Code < 500,
+			Err:        err,
+		}
+
+		if match := enhancedCode.FindStringSubmatch(reply.Msg); match != nil {
+			derr.EnhancedCode = match[1]
+		}
+		return derr
+	}
+
+	if errors.Is(err, email.ErrClosed) {
+		return Permanent(err)
+	}
+	return err
+}
+
+// Classifies a SendGrid response that does not have a 2xx status code; timeouts, rate
+// limits, and server errors are retryable and any other status (e.g. a bad request or
+// an invalid api key) is permanent.
+func newSendGridError(rep *rest.Response) error {
+	derr := &DeliveryError{
+		Backend:    "sendgrid",
+		StatusCode: rep.StatusCode,
+		Body:       rep.Body,
+	}
+
+	switch {
+	case rep.StatusCode == http.StatusTooManyRequests:
+		derr.Retryable = true
+		derr.RetryAfter = retryAfter(http.Header(rep.Headers))
+	case rep.StatusCode == http.StatusRequestTimeout:
+		derr.Retryable = true
+	case rep.StatusCode >= 500:
+		derr.Retryable = true
+	}
+
+	if derr.Body == "" {
+		derr.Body = http.StatusText(rep.StatusCode)
+	}
+	return derr
+}
+
+// Permanent marks the error so that it is not retried by Send. Backends should return
+// permanent errors for failures that will not succeed if the delivery is attempted
+// again, e.g. an email that cannot be rendered.
+func Permanent(err error) error {
+	var permanent *backoff.PermanentError
+	if errors.As(err, &permanent) {
+		return err
+	}
+	return backoff.Permanent(err)
+}
+
+// Errors that are caused by the email or the configuration and will not succeed if the
+// delivery is attempted again.
+var permanentErrors = []error{
+	ErrAttachmentRead, ErrAttachmentTooLarge, ErrIncorrectEmail, ErrInvalidContentType,
+	ErrInvalidHeader, ErrInvalidMessageID, ErrMissingAttachmentData, ErrMissingAttachmentName,
+	ErrMissingKey, ErrMissingRecipient, ErrMissingSender, ErrMissingSubject, ErrMissingTemplate,
+	ErrNoBackend, ErrNotInitialized, ErrReservedHeader, ErrSchemaMismatch, ErrTemplateNotFound, ErrTemplatesNotLoaded,
+}
+
+// Retryable returns true if the error of a delivery attempt may succeed if the email is
+// sent again. Delivery errors are retryable if the provider reported a temporary failure
+// (e.g. SMTP 4xx replies, SendGrid 429 and 5xx responses); validation and rendering
+// errors and errors marked with Permanent are not. Other errors, such as network errors,
+// are retryable.
+func Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var permanent *backoff.PermanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+
+	var derr *DeliveryError
+	if errors.As(err, &derr) {
+		return derr.Retryable
+	}
+
+	var terr *TemplateError
+	if errors.As(err, &terr) {
+		return false
+	}
+
+	for _, target := range permanentErrors {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	return true
+}
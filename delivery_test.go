@@ -0,0 +1,97 @@
+package commo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+func TestRetryable(t *testing.T) {
+	m, err := commo.NewMailer(commo.Config{}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	_, _, unknownTemplate := m.Render("unknown", nil)
+	require.ErrorIs(t, unknownTemplate, commo.ErrTemplateNotFound)
+
+	testCases := []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{io.ErrUnexpectedEOF, true},
+		{errors.New("connection reset by peer"), true},
+		{&commo.DeliveryError{Backend: "smtp", StatusCode: 421, Retryable: true}, true},
+		{&commo.DeliveryError{Backend: "smtp", StatusCode: 550}, false},
+		{fmt.Errorf("wrapped: %w", &commo.DeliveryError{Backend: "sendgrid", StatusCode: 429, Retryable: true}), true},
+		{commo.Permanent(io.ErrUnexpectedEOF), false},
+		{commo.ErrMissingRecipient, false},
+		{fmt.Errorf("invalid email: %w", commo.ErrIncorrectEmail), false},
+		{&commo.TemplateError{Template: "welcome.txt", Err: errors.New("bad template")}, false},
+		{unknownTemplate, false},
+	}
+
+	for i, tc := range testCases {
+		require.Equal(t, tc.retryable, commo.Retryable(tc.err), "test case %d failed", i)
+	}
+}
+
+func TestDeliveryError(t *testing.T) {
+	err := &commo.DeliveryError{Backend: "smtp", StatusCode: 550, EnhancedCode: "5.1.1", Body: "5.1.1 Mailbox does not exist"}
+	require.EqualError(t, err, "smtp delivery failed with status 550: 5.1.1 Mailbox does not exist")
+	require.True(t, err.BadRecipient())
+
+	// Without an enhanced code the reply code is used to detect bad recipients.
+	err = &commo.DeliveryError{Backend: "smtp", StatusCode: 550, Body: "Mailbox unavailable"}
+	require.True(t, err.BadRecipient())
+
+	err = &commo.DeliveryError{Backend: "smtp", StatusCode: 452, EnhancedCode: "4.2.2", Body: "4.2.2 Mailbox full"}
+	require.False(t, err.BadRecipient(), "temporary failures are not bad recipients")
+
+	err = &commo.DeliveryError{Backend: "sendgrid", StatusCode: 400, Body: `{"errors":[]}`}
+	require.False(t, err.BadRecipient())
+}
+
+func TestPermanentErrorsNotRetried(t *testing.T) {
+	conf := commo.Config{
+		Sender:  "test@example.com",
+		Backoff: fastBackoff(),
+	}
+
+	rejected := &commo.DeliveryError{Backend: "func", StatusCode: 550, Body: "rejected"}
+	testCases := []error{
+		commo.Permanent(errors.New("custom backend failure")),
+		rejected,
+	}
+
+	for i, expected := range testCases {
+		attempts := 0
+		backend := backendFunc(func(context.Context, *commo.Message) error {
+			attempts++
+			return expected
+		})
+
+		m, err := commo.NewMailerWithBackend(conf, backend, loadTestTemplates())
+		require.NoError(t, err, "could not create mailer")
+
+		email, err := m.New("test@example.com", "Test Subject", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		err = email.Send()
+		require.Error(t, err, "test case %d expected an error", i)
+		require.Equal(t, 1, attempts, "test case %d expected no retries", i)
+	}
+
+	// The delivery error is returned to the caller without the permanent wrapper.
+	backend := backendFunc(func(context.Context, *commo.Message) error { return rejected })
+	m, err := commo.NewMailerWithBackend(conf, backend, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	email, err := m.New("test@example.com", "Test Subject", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+	require.Same(t, rejected, email.Send())
+}
@@ -1,6 +1,7 @@
 package commo
 
 import (
+	"context"
 	"fmt"
 	"net/mail"
 
@@ -12,26 +13,45 @@ import (
 type Email struct {
 	Sender   string
 	To       []string
+	CC       []string
+	BCC      []string // never included in the headers of the message
+	ReplyTo  string
 	Subject  string
 	Template string
 	Data     any
+
+	Attachments []*Attachment
+
+	// Additional headers such as List-Id or X-Entity-Ref-ID; headers that are managed
+	// by commo or the email provider (e.g. From, Subject, Content-Type) are rejected.
+	Headers map[string]string
+
+	// Threading headers; ids may be specified with or without angle brackets. If the
+	// MessageID is empty, one is generated from the sender domain when the email is
+	// prepared; retries deliver the same message and so use the same id.
+	MessageID  string
+	InReplyTo  string
+	References []string
+
+	// Tags categorize the email for the analytics of the provider; they are sent as
+	// categories by the SendGrid backend.
+	Tags []string
+
+	// The locale to render the email in, e.g. fr-CA; the most specific localized
+	// variant of the template is used (welcome.fr-CA, then welcome.fr, then welcome).
+	// If empty, the default templates are rendered.
+	Locale string
+
+	// The mailer the email was created by, if nil the default mailer is used.
+	mailer *Mailer
 }
 
 // New creates a new email template with the currently configured sender attached. If
 // the sender is not configured, then it is left empty; otherwise if the module has
-// been configured and there is no sender, an error is returned.
+// been configured and there is no sender, an error is returned. If the subject is
+// empty it is rendered from the subject block of the template; see Mailer.New.
 func New(recipient, subject, template string, data any) (*Email, error) {
-	msg := &Email{
-		To:       []string{recipient},
-		Subject:  subject,
-		Template: template,
-		Data:     data,
-	}
-
-	if initialized {
-		msg.Sender = config.Sender
-	}
-	return msg, nil
+	return defaultMailer().create(recipient, subject, template, data)
 }
 
 // Validate that all required data is present to assemble a sendable email.
@@ -47,70 +67,89 @@ func (e *Email) Validate() error {
 		return ErrMissingTemplate
 	}
 
-	if _, err := mail.ParseAddress(e.Sender); err != nil {
-		return fmt.Errorf("invalid sender email address %q: %w", e.Sender, ErrIncorrectEmail)
+	if err := validateAddresses(e.Sender, e.ReplyTo, e.To, e.CC, e.BCC); err != nil {
+		return err
 	}
 
-	for _, to := range e.To {
-		if _, err := mail.ParseAddress(to); err != nil {
-			return fmt.Errorf("invalid recipient email address %q: %w", to, ErrIncorrectEmail)
+	for _, attachment := range e.Attachments {
+		if err := attachment.Validate(); err != nil {
+			return err
 		}
 	}
 
+	return e.validateHeaders()
+}
+
+// Validate that the sender, reply to, and recipient email addresses can be parsed.
+func validateAddresses(sender, replyTo string, to, cc, bcc []string) error {
+	if _, err := mail.ParseAddress(sender); err != nil {
+		return fmt.Errorf("invalid sender email address %q: %w", sender, ErrIncorrectEmail)
+	}
+
+	if replyTo != "" {
+		if _, err := mail.ParseAddress(replyTo); err != nil {
+			return fmt.Errorf("invalid reply to email address %q: %w", replyTo, ErrIncorrectEmail)
+		}
+	}
+
+	for _, recipients := range []struct {
+		kind  string
+		addrs []string
+	}{{"recipient", to}, {"cc", cc}, {"bcc", bcc}} {
+		for _, addr := range recipients.addrs {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return fmt.Errorf("invalid %s email address %q: %w", recipients.kind, addr, ErrIncorrectEmail)
+			}
+		}
+	}
 	return nil
 }
 
-// Helper method to send an email using the commo.Send package function.
+// Helper method to send an email using the mailer that created it or the commo.Send
+// package function if the email was not created by a mailer.
 func (e *Email) Send() error {
-	return Send(e)
+	return e.getMailer().Send(e)
 }
 
-// Return an email struct that can be sent via SMTP
-func (e *Email) ToSMTP() (msg *email.Email, err error) {
-	if err = e.Validate(); err != nil {
-		return nil, err
-	}
+// SendContext sends the email like Send but stops retrying when the context is done.
+func (e *Email) SendContext(ctx context.Context) error {
+	return e.getMailer().SendContext(ctx, e)
+}
 
-	msg = email.NewEmail()
-	msg.From = e.Sender
-	msg.To = e.To
-	msg.Subject = e.Subject
+func (e *Email) getMailer() *Mailer {
+	if e.mailer != nil {
+		return e.mailer
+	}
+	return defaultMailer()
+}
 
-	if msg.Text, msg.HTML, err = Render(e.Template, e.Data); err != nil {
-		return nil, err
+// Returns the attachments of the email along with the inline images registered with
+// the mailer that are referenced by the rendered html.
+func (e *Email) withInline(mailer *Mailer, html []byte) []*Attachment {
+	inline := mailer.inline(html, e.Attachments)
+	if len(inline) == 0 {
+		return e.Attachments
 	}
 
-	return msg, nil
+	attachments := make([]*Attachment, 0, len(e.Attachments)+len(inline))
+	attachments = append(attachments, e.Attachments...)
+	return append(attachments, inline...)
 }
 
-// Return an email struct that can be sent via SendGrid
-func (e *Email) ToSendGrid() (msg *sgmail.SGMailV3, err error) {
-	if err = e.Validate(); err != nil {
+// Return an email struct that can be sent via SMTP
+func (e *Email) ToSMTP() (_ *email.Email, err error) {
+	var msg *Message
+	if msg, err = e.Prepare(); err != nil {
 		return nil, err
 	}
+	return msg.ToSMTP()
+}
 
-	// See: https://github.com/sendgrid/sendgrid-go/blob/16f25e4d92886b2733473a19977ccf1aa625a89b/helpers/mail/mail_v3.go#L186-L195
-	msg = new(sgmail.SGMailV3)
-	msg.Subject = e.Subject
-	msg.SetFrom(MustNewSGEmail(e.Sender))
-
-	p := sgmail.NewPersonalization()
-	p.AddTos(MustNewSGEmails(e.To)...)
-	msg.AddPersonalizations(p)
-
-	var (
-		text string
-		html string
-	)
-
-	if text, html, err = RenderString(e.Template, e.Data); err != nil {
+// Return an email struct that can be sent via SendGrid
+func (e *Email) ToSendGrid() (_ *sgmail.SGMailV3, err error) {
+	var msg *Message
+	if msg, err = e.Prepare(); err != nil {
 		return nil, err
 	}
-
-	msg.AddContent(
-		sgmail.NewContent("text/plain", text),
-		sgmail.NewContent("text/html", html),
-	)
-
-	return msg, nil
+	return msg.ToSendGrid()
 }
@@ -3,6 +3,7 @@ package commo_test
 import (
 	"testing"
 
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
 	"github.com/stretchr/testify/require"
 	"go.rtnl.ai/commo"
 )
@@ -11,18 +12,27 @@ func TestEmailValidate(t *testing.T) {
 	t.Run("Valid", func(t *testing.T) {
 		testCases := []*commo.Email{
 			{
-				"admin@server.com",
-				[]string{"test@example.com"},
-				"This is a test email",
-				"test",
-				nil,
+				Sender:   "admin@server.com",
+				To:       []string{"test@example.com"},
+				Subject:  "This is a test email",
+				Template: "test",
+				Data:     nil,
 			},
 			{
-				"admin@server.com",
-				[]string{"test@example.com"},
-				"This is a test email",
-				"test",
-				map[string]any{"count": 4},
+				Sender:   "admin@server.com",
+				To:       []string{"test@example.com"},
+				Subject:  "This is a test email",
+				Template: "test",
+				Data:     map[string]any{"count": 4},
+			},
+			{
+				Sender:   "admin@server.com",
+				To:       []string{"test@example.com"},
+				CC:       []string{"Account Owner <owner@example.com>"},
+				BCC:      []string{"audit@server.com"},
+				ReplyTo:  "Support <support@server.com>",
+				Subject:  "This is a test email",
+				Template: "test",
 			},
 		}
 
@@ -92,6 +102,36 @@ func TestEmailValidate(t *testing.T) {
 				},
 				commo.ErrIncorrectEmail,
 			},
+			{
+				&commo.Email{
+					Sender:   "admin@server.com",
+					To:       []string{"test@example.com"},
+					CC:       []string{"owner@@example.com"},
+					Subject:  "This is a test email",
+					Template: "test",
+				},
+				commo.ErrIncorrectEmail,
+			},
+			{
+				&commo.Email{
+					Sender:   "admin@server.com",
+					To:       []string{"test@example.com"},
+					BCC:      []string{"audit"},
+					Subject:  "This is a test email",
+					Template: "test",
+				},
+				commo.ErrIncorrectEmail,
+			},
+			{
+				&commo.Email{
+					Sender:   "admin@server.com",
+					To:       []string{"test@example.com"},
+					ReplyTo:  "support@",
+					Subject:  "This is a test email",
+					Template: "test",
+				},
+				commo.ErrIncorrectEmail,
+			},
 		}
 
 		for i, tc := range testCases {
@@ -100,3 +140,40 @@ func TestEmailValidate(t *testing.T) {
 	})
 
 }
+
+func TestEmailRecipients(t *testing.T) {
+	mailer, err := commo.NewMailer(commo.Config{}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	email, err := mailer.New("Tess Tester <tess@example.com>", "Recipients", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+	email.Sender = "Jane Szack <jane@example.com>"
+	email.CC = []string{"Account Owner <owner@example.com>"}
+	email.BCC = []string{"audit@example.com"}
+	email.ReplyTo = "Support <support@example.com>"
+
+	t.Run("SMTP", func(t *testing.T) {
+		msg, err := email.ToSMTP()
+		require.NoError(t, err, "could not create smtp email")
+		require.Equal(t, []string{"Tess Tester <tess@example.com>"}, msg.To)
+		require.Equal(t, []string{"Account Owner <owner@example.com>"}, msg.Cc)
+		require.Equal(t, []string{"audit@example.com"}, msg.Bcc)
+		require.Equal(t, []string{"Support <support@example.com>"}, msg.ReplyTo)
+
+		raw, err := msg.Bytes()
+		require.NoError(t, err, "could not render smtp email")
+		require.Contains(t, string(raw), "Cc: \"Account Owner\" <owner@example.com>")
+		require.Contains(t, string(raw), "Reply-To: Support <support@example.com>")
+		require.NotContains(t, string(raw), "audit@example.com", "bcc address leaked into the message")
+	})
+
+	t.Run("SendGrid", func(t *testing.T) {
+		msg, err := email.ToSendGrid()
+		require.NoError(t, err, "could not create sendgrid email")
+		require.Len(t, msg.Personalizations, 1)
+		require.Equal(t, []*sgmail.Email{{Name: "Tess Tester", Address: "tess@example.com"}}, msg.Personalizations[0].To)
+		require.Equal(t, []*sgmail.Email{{Name: "Account Owner", Address: "owner@example.com"}}, msg.Personalizations[0].CC)
+		require.Equal(t, []*sgmail.Email{{Name: "", Address: "audit@example.com"}}, msg.Personalizations[0].BCC)
+		require.Equal(t, &sgmail.Email{Name: "Support", Address: "support@example.com"}, msg.ReplyTo)
+	})
+}
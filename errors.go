@@ -3,24 +3,44 @@ package commo
 import "errors"
 
 var (
-	ErrIncorrectEmail     = errors.New("could not parse email address")
-	ErrMissingRecipient   = errors.New("missing email recipient(s)")
-	ErrMissingSender      = errors.New("missing email sender")
-	ErrMissingSubject     = errors.New("missing email subject")
-	ErrMissingTemplate    = errors.New("missing email template name")
-	ErrNotInitialized     = errors.New("email sending method has not been configured")
-	ErrTemplatesNotLoaded = errors.New("templates have not been loaded yet")
+	ErrAttachmentRead        = errors.New("attachment reader has already been read")
+	ErrAttachmentTooLarge    = errors.New("email attachments exceed the size limit of the email provider")
+	ErrIncorrectEmail        = errors.New("could not parse email address")
+	ErrInvalidCatalog        = errors.New("could not load message catalog")
+	ErrInvalidContentType    = errors.New("could not parse attachment content type")
+	ErrInvalidHeader         = errors.New("header names must be printable ascii and values cannot contain line breaks")
+	ErrInvalidMessageID      = errors.New("could not parse message id")
+	ErrMissingAttachmentData = errors.New("missing attachment data or reader")
+	ErrMissingAttachmentName = errors.New("missing attachment filename")
+	ErrMissingCounterpart    = errors.New("email templates require both a text and an html template")
+	ErrMissingKey            = errors.New("template data is missing keys referenced by the template")
+	ErrMissingRecipient      = errors.New("missing email recipient(s)")
+	ErrMissingSender         = errors.New("missing email sender")
+	ErrMissingSubject        = errors.New("missing email subject")
+	ErrMissingTemplate       = errors.New("missing email template name")
+	ErrMockTimeout           = errors.New("timed out waiting for emails to be sent to the mock outbox")
+	ErrNoBackend             = errors.New("no backend is available to send emails")
+	ErrNotInitialized        = errors.New("email sending method has not been configured")
+	ErrQueueClosed           = errors.New("the send queue has been shut down")
+	ErrQueueFull             = errors.New("the send queue is full")
+	ErrReservedHeader        = errors.New("header is managed by commo or the email provider and cannot be set")
+	ErrSchemaMismatch        = errors.New("templates do not match their declared data types")
+	ErrTemplateNotFound      = errors.New("template does not exist")
+	ErrTemplatesNotLoaded    = errors.New("templates have not been loaded yet")
 )
 
 var (
 	ErrConfigConflict        = errors.New("invalid configuration: cannot specify configuration for both smtp and sendgrid")
 	ErrConfigCRAMMD5Auth     = errors.New("invalid configuration: smtp cram-md5 requires username and password")
 	ErrConfigInitialInterval = errors.New("invalid configuration: initial interval must be greater than zero")
+	ErrConfigInvalidBaseURL  = errors.New("invalid configuration: could not parse sendgrid base url")
 	ErrConfigInvalidSender   = errors.New("invalid configuration: could not parse sender email address")
 	ErrConfigMaxElapsedTime  = errors.New("invalid configuration: max elapsed time must be greater than zero")
 	ErrConfigMaxInterval     = errors.New("invalid configuration: max interval must be greater than zero")
 	ErrConfigMissingPort     = errors.New("invalid configuration: smtp port is required")
 	ErrConfigMissingSender   = errors.New("invalid configuration: sender email is required")
 	ErrConfigPoolSize        = errors.New("invalid configuration: smtp connections pool size must be greater than zero")
+	ErrConfigQueueSize       = errors.New("invalid configuration: queue size cannot be negative")
+	ErrConfigQueueWorkers    = errors.New("invalid configuration: queue workers cannot be negative")
 	ErrConfigTimeout         = errors.New("invalid configuration: timeout must be greater than zero")
 )
@@ -0,0 +1,192 @@
+package commo
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// FuncMap returns the template functions provided by commo. The functions are added
+// to the templates by LoadTemplates; templates that are parsed manually must add the
+// functions before they are parsed, e.g.
+//
+//	template.New(name).Funcs(commo.FuncMap()).ParseFS(fsys, patterns...)
+//
+// The following functions are available:
+//
+//	cid "logo.png"                         the src url of an inline image registered with Embed
+//	locale                                 the locale the template is rendered in
+//	t "Welcome, %s!" .Name                 the translation of the message in the locale
+//	plural "%d item" "%d items" .Count     the plural form of the message for the count
+//	date "long" .CreatedAt                 the date in the locale (short, medium, long, full)
+//	date "long" .CreatedAt "Europe/Paris"  the date in the time zone
+//	duration .ExpiresIn                    the duration rounded to its largest unit, e.g. 2 hours
+//	number .Total                          the number with the separators of the locale
+//	currency "EUR" .Total                  the amount formatted with the currency symbol
+//	upper .Name                            the string in upper case (or lower)
+//	truncate 80 .Body                      the string shortened to 80 characters with an ellipsis
+//	default "there" .Name                  the value, or the default if the value is empty
+//	safeURL .Link                          the url marked as safe so that it is not filtered
+//	safeAttr .Attr                         the attribute, e.g. data-id="1", marked as safe
+//	button "Sign in" .URL                  a call to action button that renders in all clients
+//	button "Sign in" .URL "#1a73e8"        the button with a background color
+//
+// Functions that accept the value last can be used in pipelines, e.g.
+// {{ .Name | default "there" }}. Date styles other than the named styles are Go time
+// layouts, e.g. "15:04 MST".
+//
+// The functions returned by FuncMap use the default locale and do not translate
+// messages; LoadTemplates binds them to the locale and message catalogs of the
+// templates. In text templates, buttons are written as the text and url of the link.
+func FuncMap() template.FuncMap {
+	funcs := template.FuncMap{
+		"cid":      cid,
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"truncate": truncate,
+		"default":  defaultValue,
+		"safeURL":  safeURL,
+		"safeAttr": safeAttr,
+		"button":   button,
+	}
+
+	for name, fn := range localeFuncs("", nil) {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// Functions that are replaced in text templates since they render html.
+func textFuncs() template.FuncMap {
+	return template.FuncMap{
+		"button": textButton,
+	}
+}
+
+// Shorten the string to at most n characters including the ellipsis; the string is
+// cut at the last space if possible so that words are not split.
+func truncate(n int, s string) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	runes := []rune(s)
+	cut := string(runes[:max(n-1, 0)])
+	if i := strings.LastIndexByte(cut, ' '); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// Returns the value unless it is nil or the zero value of its type (e.g. an empty
+// string, slice, or map), otherwise the default is returned.
+func defaultValue(def, value any) any {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return def
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		if v.Len() == 0 {
+			return def
+		}
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return def
+		}
+	default:
+		if v.IsZero() {
+			return def
+		}
+	}
+	return value
+}
+
+// Mark the url as safe so that html/template does not filter it, e.g. a url with a
+// custom scheme. Only use with trusted urls.
+func safeURL(s string) template.URL {
+	return template.URL(s)
+}
+
+// Mark the attribute as safe so that it can be added to an element by html/template.
+// Only use with trusted attributes.
+func safeAttr(s string) template.HTMLAttr {
+	return template.HTMLAttr(s)
+}
+
+// Default colors of the call to action button; they match the primary button of the
+// base layout, which overrides them in dark mode with the button-td-primary class.
+const (
+	buttonBackground = "#222222"
+	buttonBorder     = "#000000"
+	buttonColor      = "#ffffff"
+)
+
+// Renders a bulletproof call to action button: a table cell with the background color
+// so that the button is displayed even if the client does not support the padding
+// of links (e.g. Outlook) and a block link so that the entire button is clickable.
+func button(text, href string, background ...string) (template.HTML, error) {
+	bg, border := buttonBackground, buttonBorder
+	if len(background) > 0 {
+		if !isColor(background[0]) {
+			return "", fmt.Errorf("invalid button color %q", background[0])
+		}
+		bg, border = background[0], background[0]
+	}
+
+	if !safeHref(href) {
+		return "", fmt.Errorf("invalid button url %q", href)
+	}
+
+	text = template.HTMLEscapeString(text)
+	href = template.HTMLEscapeString(href)
+
+	var sb strings.Builder
+	sb.WriteString(`<table align="center" role="presentation" cellspacing="0" cellpadding="0" border="0" style="margin: auto;">`)
+	fmt.Fprintf(&sb, `<tr><td class="button-td button-td-primary" style="border-radius: 4px; background: %s;">`, bg)
+	fmt.Fprintf(&sb, `<a class="button-a button-a-primary" href="%s" style="background: %s; border: 1px solid %s; font-family: sans-serif; font-size: 15px; line-height: 15px; text-decoration: none; padding: 13px 17px; color: %s; display: block; border-radius: 4px;">%s</a>`, href, bg, border, buttonColor, text)
+	sb.WriteString(`</td></tr></table>`)
+	return template.HTML(sb.String()), nil
+}
+
+// Renders the call to action button in text templates as the text and url of the link.
+func textButton(text, href string, _ ...string) string {
+	return text + " [" + href + "]"
+}
+
+// Returns true if the url is safe to use as the href of a link.
+func safeHref(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto", "tel", "":
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns true if the string is a hex color or a css color name.
+func isColor(s string) bool {
+	if strings.HasPrefix(s, "#") {
+		hex := s[1:]
+		if len(hex) != 3 && len(hex) != 6 {
+			return false
+		}
+
+		for _, c := range hex {
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+		return true
+	}
+	return s != "" && isAlpha(s)
+}
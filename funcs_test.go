@@ -0,0 +1,112 @@
+package commo_test
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+func TestFuncMap(t *testing.T) {
+	testCases := []struct {
+		template string
+		data     any
+		expected string
+	}{
+		{`{{ upper .Name }} {{ lower .Name }}`, map[string]any{"Name": "Jane Doe"}, "JANE DOE jane doe"},
+		{`{{ truncate 12 .Body }}`, map[string]any{"Body": "The quick brown fox"}, "The quick…"},
+		{`{{ truncate 12 .Body }}`, map[string]any{"Body": "Short body"}, "Short body"},
+		{`{{ truncate 6 .Body }}`, map[string]any{"Body": "Supercalifragilistic"}, "Super…"},
+		{`Hi {{ .Name | default "there" }}!`, map[string]any{"Name": ""}, "Hi there!"},
+		{`Hi {{ .Name | default "there" }}!`, map[string]any{}, "Hi there!"},
+		{`Hi {{ .Name | default "there" }}!`, map[string]any{"Name": "Jane"}, "Hi Jane!"},
+		{`{{ .Count | default 1 }}`, map[string]any{"Count": 0}, "1"},
+		{`<a href="{{ .Link }}">`, map[string]any{"Link": "app://open"}, `<a href="#ZgotmplZ">`},
+		{`<a href="{{ safeURL .Link }}">`, map[string]any{"Link": "app://open"}, `<a href="app://open">`},
+		{`<td {{ safeAttr .Attr }}>`, map[string]any{"Attr": `data-id="1"`}, `<td data-id="1">`},
+		{`{{ date "long" .At "America/New_York" }}`, map[string]any{"At": time.Date(2025, 3, 7, 2, 0, 0, 0, time.UTC)}, "March 6, 2025"},
+		{`{{ date "15:04 MST" .At "Europe/Paris" }}`, map[string]any{"At": time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC)}, "13:00 CET"},
+		{`{{ duration .In }}`, map[string]any{"In": 90 * time.Minute}, "2 hours"},
+		{`{{ duration .In }}`, map[string]any{"In": 24 * time.Hour}, "1 day"},
+		{`{{ duration .In }}`, map[string]any{"In": "45s"}, "45 seconds"},
+		{`{{ duration .In }}`, map[string]any{"In": time.Duration(0)}, "0 seconds"},
+	}
+
+	for i, tc := range testCases {
+		fsys := fstest.MapFS{"test.html": {Data: []byte(tc.template)}}
+		templates, err := commo.LoadTemplates(fsys, commo.Layout{GenerateText: true})
+		require.NoError(t, err, "test case %d errored", i)
+
+		mailer, err := commo.NewMailer(commo.Config{}, templates)
+		require.NoError(t, err, "test case %d errored", i)
+
+		_, html, err := mailer.Render("test", tc.data)
+		require.NoError(t, err, "test case %d errored", i)
+		require.Equal(t, tc.expected, string(html), "test case %d failed", i)
+	}
+}
+
+func TestButton(t *testing.T) {
+	fsys := fstest.MapFS{
+		"cta.html": {Data: []byte(`{{ button .Text .URL }}{{ button "Go" "/go" "#1a73e8" }}`)},
+		"cta.txt":  {Data: []byte(`{{ button .Text .URL }}`)},
+	}
+
+	templates, err := commo.LoadTemplates(fsys, commo.DefaultLayout)
+	require.NoError(t, err, "could not load templates")
+
+	mailer, err := commo.NewMailer(commo.Config{}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	text, html, err := mailer.Render("cta", map[string]string{"Text": "Reset <Password>", "URL": "https://example.com/reset?token=a&b"})
+	require.NoError(t, err, "could not render button")
+	require.Equal(t, "Reset <Password> [https://example.com/reset?token=a&b]", string(text))
+	require.Contains(t, string(html), `<td class="button-td button-td-primary" style="border-radius: 4px; background: #222222;">`)
+	require.Contains(t, string(html), `href="https://example.com/reset?token=a&amp;b"`)
+	require.Contains(t, string(html), `>Reset &lt;Password&gt;</a>`)
+	require.Contains(t, string(html), `background: #1a73e8; border: 1px solid #1a73e8;`)
+
+	// The button is converted to a link when the text is generated.
+	generated, err := commo.HTMLToText(html)
+	require.NoError(t, err, "could not generate text")
+	require.Contains(t, string(generated), "Reset <Password> [https://example.com/reset?token=a&b]")
+
+	_, _, err = mailer.Render("cta", map[string]string{"Text": "Run", "URL": "javascript:alert(1)"})
+	require.Error(t, err, "expected unsafe urls to be rejected")
+
+	fsys["cta.html"] = &fstest.MapFile{Data: []byte(`{{ button "Go" "/go" "red;x:y" }}`)}
+	templates, err = commo.LoadTemplates(fsys, commo.DefaultLayout)
+	require.NoError(t, err, "could not load templates")
+
+	mailer, err = commo.NewMailer(commo.Config{}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	_, _, err = mailer.Render("cta", nil)
+	require.Error(t, err, "expected invalid colors to be rejected")
+}
+
+func TestLocalizedDuration(t *testing.T) {
+	fsys := fstest.MapFS{
+		"expires.html": {Data: []byte(`{{ duration .In }}`)},
+		"locales/fr.json": {Data: []byte(`{
+			"%d hour": {"one": "%d heure", "other": "%d heures"},
+			"%d day": {"one": "%d jour", "other": "%d jours"}
+		}`)},
+	}
+
+	templates, err := commo.LoadTemplates(fsys, commo.Layout{GenerateText: true})
+	require.NoError(t, err, "could not load templates")
+
+	mailer, err := commo.NewMailer(commo.Config{}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	_, html, err := mailer.Localized("fr").Render("expires", map[string]any{"In": 48 * time.Hour})
+	require.NoError(t, err, "could not render duration")
+	require.Equal(t, "2 jours", string(html))
+
+	_, html, err = mailer.Localized("fr").Render("expires", map[string]any{"In": time.Hour})
+	require.NoError(t, err, "could not render duration")
+	require.Equal(t, "1 heure", string(html))
+}
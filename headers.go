@@ -0,0 +1,166 @@
+package commo
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers that are managed by commo or the email provider and cannot be set with the
+// Headers map of an email. The threading headers are set with the MessageID,
+// InReplyTo, and References fields of the email instead.
+var reservedHeaders = map[string]struct{}{
+	"Bcc":                       {},
+	"Cc":                        {},
+	"Content-Transfer-Encoding": {},
+	"Content-Type":              {},
+	"Date":                      {},
+	"Dkim-Signature":            {},
+	"From":                      {},
+	"In-Reply-To":               {},
+	"Message-Id":                {},
+	"Mime-Version":              {},
+	"Received":                  {},
+	"References":                {},
+	"Reply-To":                  {},
+	"Subject":                   {},
+	"To":                        {},
+	"X-Sg-Eid":                  {},
+	"X-Sg-Id":                   {},
+}
+
+// NewMessageID generates a unique Message-ID whose domain is the domain of the sender
+// email address, e.g. <1a2b3c.xyz@example.com>. Generating the id ahead of sending
+// allows an application to store it so that replies can be threaded to the email.
+func NewMessageID(sender string) (_ string, err error) {
+	var addr *mail.Address
+	if addr, err = mail.ParseAddress(sender); err != nil {
+		return "", fmt.Errorf("invalid sender email address %q: %w", sender, ErrIncorrectEmail)
+	}
+
+	domain := addr.Address[strings.LastIndexByte(addr.Address, '@')+1:]
+	local := strconv.FormatInt(time.Now().UnixNano(), 36) + "." + strings.ToLower(rand.Text())
+	return "<" + local + "@" + domain + ">", nil
+}
+
+// Validate the custom and threading headers of the email.
+func (e *Email) validateHeaders() error {
+	for key, value := range e.Headers {
+		if err := validateHeader(key, value); err != nil {
+			return err
+		}
+	}
+
+	ids := make([]string, 0, len(e.References)+2)
+	if e.MessageID != "" {
+		ids = append(ids, e.MessageID)
+	}
+	if e.InReplyTo != "" {
+		ids = append(ids, e.InReplyTo)
+	}
+	ids = append(ids, e.References...)
+
+	for _, id := range ids {
+		if !validMessageID(id) {
+			return fmt.Errorf("message id %q: %w", id, ErrInvalidMessageID)
+		}
+	}
+	return nil
+}
+
+// Validate the headers of a message. Unlike an email, the headers of a message include
+// the threading headers that were generated when the email was prepared.
+func (m *Message) validateHeaders() error {
+	for key, value := range m.headers {
+		switch textproto.CanonicalMIMEHeaderKey(key) {
+		case "Message-Id", "In-Reply-To", "References":
+			for _, id := range strings.Fields(value) {
+				if !validMessageID(id) {
+					return fmt.Errorf("message id %q: %w", id, ErrInvalidMessageID)
+				}
+			}
+
+			if strings.TrimSpace(value) == "" || strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("header %q: %w", key, ErrInvalidHeader)
+			}
+		default:
+			if err := validateHeader(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// A custom header must have a valid field name and value and cannot be reserved.
+func validateHeader(key, value string) error {
+	if !validHeaderKey(key) || strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("header %q: %w", key, ErrInvalidHeader)
+	}
+
+	if _, ok := reservedHeaders[textproto.CanonicalMIMEHeaderKey(key)]; ok {
+		return fmt.Errorf("header %q: %w", key, ErrReservedHeader)
+	}
+	return nil
+}
+
+// Returns all of the headers that should be added to the message, including the
+// threading headers. If the email does not have a Message-ID one is generated for the
+// message; the email is not modified so that it can be prepared concurrently.
+func (e *Email) headers() (_ map[string]string, err error) {
+	id := e.MessageID
+	if id == "" {
+		if id, err = NewMessageID(e.Sender); err != nil {
+			return nil, err
+		}
+	}
+
+	headers := make(map[string]string, len(e.Headers)+3)
+	for key, value := range e.Headers {
+		headers[key] = value
+	}
+
+	headers["Message-ID"] = angleAddr(id)
+	if e.InReplyTo != "" {
+		headers["In-Reply-To"] = angleAddr(e.InReplyTo)
+	}
+
+	if len(e.References) > 0 {
+		refs := make([]string, 0, len(e.References))
+		for _, ref := range e.References {
+			refs = append(refs, angleAddr(ref))
+		}
+		headers["References"] = strings.Join(refs, " ")
+	}
+	return headers, nil
+}
+
+// Message-IDs may be specified with or without the enclosing angle brackets.
+func angleAddr(id string) string {
+	return "<" + strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">") + ">"
+}
+
+// A Message-ID must have a local part and a domain and cannot contain whitespace.
+func validMessageID(id string) bool {
+	id = strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+	at := strings.LastIndexByte(id, '@')
+	return at > 0 && at < len(id)-1 && !strings.ContainsAny(id, " \t\r\n<>")
+}
+
+// Header field names must be printable US-ASCII characters other than the colon.
+func validHeaderKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c <= ' ' || c > '~' || c == ':' {
+			return false
+		}
+	}
+	return true
+}
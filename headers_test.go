@@ -0,0 +1,120 @@
+package commo_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+	"go.rtnl.ai/commo/commotest"
+)
+
+func TestNewMessageID(t *testing.T) {
+	id, err := commo.NewMessageID("Jane Szack <jane@example.com>")
+	require.NoError(t, err, "could not generate message id")
+	require.True(t, strings.HasPrefix(id, "<"), "expected message id to be enclosed in angle brackets")
+	require.True(t, strings.HasSuffix(id, "@example.com>"), "expected message id to use the sender domain")
+
+	other, err := commo.NewMessageID("jane@example.com")
+	require.NoError(t, err, "could not generate message id")
+	require.NotEqual(t, id, other, "expected message ids to be unique")
+
+	_, err = commo.NewMessageID("not an email")
+	require.ErrorIs(t, err, commo.ErrIncorrectEmail)
+}
+
+func TestEmailHeadersValidate(t *testing.T) {
+	testCases := []struct {
+		email *commo.Email
+		err   error
+	}{
+		{&commo.Email{Headers: map[string]string{"List-Id": "Notifications <notifications.example.com>"}}, nil},
+		{&commo.Email{Headers: map[string]string{"X-Entity-Ref-ID": "1234"}}, nil},
+		{&commo.Email{MessageID: "<1234@example.com>", InReplyTo: "1233@example.com", References: []string{"<1232@example.com>", "1233@example.com"}}, nil},
+		{&commo.Email{Headers: map[string]string{"X-Custom Header": "value"}}, commo.ErrInvalidHeader},
+		{&commo.Email{Headers: map[string]string{"X-Custom:": "value"}}, commo.ErrInvalidHeader},
+		{&commo.Email{Headers: map[string]string{"X-Custom": "value\r\nBcc: leak@example.com"}}, commo.ErrInvalidHeader},
+		{&commo.Email{Headers: map[string]string{"subject": "Override"}}, commo.ErrReservedHeader},
+		{&commo.Email{Headers: map[string]string{"Message-ID": "<1234@example.com>"}}, commo.ErrReservedHeader},
+		{&commo.Email{Headers: map[string]string{"X-SG-ID": "1234"}}, commo.ErrReservedHeader},
+		{&commo.Email{MessageID: "1234"}, commo.ErrInvalidMessageID},
+		{&commo.Email{InReplyTo: "12 34@example.com"}, commo.ErrInvalidMessageID},
+		{&commo.Email{References: []string{"<1234@example.com>", "@example.com"}}, commo.ErrInvalidMessageID},
+	}
+
+	for i, tc := range testCases {
+		tc.email.Sender = "admin@server.com"
+		tc.email.To = []string{"test@example.com"}
+		tc.email.Subject = "This is a test email"
+		tc.email.Template = "test"
+
+		if tc.err == nil {
+			require.NoError(t, tc.email.Validate(), "test case %d failed", i)
+		} else {
+			require.ErrorIs(t, tc.email.Validate(), tc.err, "test case %d failed", i)
+		}
+	}
+}
+
+func TestEmailHeaders(t *testing.T) {
+	mailer, err := commo.NewMailer(commo.Config{}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	email, err := mailer.New("tess@example.com", "Re: Your order", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+	email.Sender = "Jane Szack <jane@example.com>"
+	email.InReplyTo = "order-1234@example.com"
+	email.References = []string{"<order-1234@example.com>", "order-1235@example.com"}
+	email.Headers = map[string]string{
+		"List-Id":         "Order Notifications <orders.example.com>",
+		"X-Entity-Ref-ID": "order-1235",
+	}
+
+	t.Run("SMTP", func(t *testing.T) {
+		msg, err := email.ToSMTP()
+		require.NoError(t, err, "could not create smtp email")
+		require.Empty(t, email.MessageID, "expected the email not to be modified")
+
+		id := msg.Headers.Get("Message-Id")
+		require.NotEmpty(t, id, "expected message id to be generated")
+		require.True(t, strings.HasSuffix(id, "@example.com>"), "expected message id to use the sender domain")
+
+		raw, err := msg.Bytes()
+		require.NoError(t, err, "could not render smtp email")
+
+		parsed, err := commotest.ParseMessage(raw)
+		require.NoError(t, err, "could not parse smtp email")
+		require.Equal(t, id, parsed.Header.Get("Message-Id"))
+		require.Equal(t, "<order-1234@example.com>", parsed.Header.Get("In-Reply-To"))
+		require.Equal(t, "<order-1234@example.com> <order-1235@example.com>", parsed.Header.Get("References"))
+		require.Equal(t, "Order Notifications <orders.example.com>", parsed.Header.Get("List-Id"))
+		require.Equal(t, "order-1235", parsed.Header.Get("X-Entity-Ref-Id"))
+	})
+
+	t.Run("SendGrid", func(t *testing.T) {
+		msg, err := email.ToSendGrid()
+		require.NoError(t, err, "could not create sendgrid email")
+		require.Empty(t, commotest.ValidateSendGrid(msg))
+		require.True(t, strings.HasSuffix(msg.Headers["Message-ID"], "@example.com>"), "expected message id to be generated")
+		require.Equal(t, map[string]string{
+			"Message-ID":      msg.Headers["Message-ID"],
+			"In-Reply-To":     "<order-1234@example.com>",
+			"References":      "<order-1234@example.com> <order-1235@example.com>",
+			"List-Id":         "Order Notifications <orders.example.com>",
+			"X-Entity-Ref-ID": "order-1235",
+		}, msg.Headers)
+	})
+
+	t.Run("Explicit", func(t *testing.T) {
+		email, err := mailer.New("tess@example.com", "Hello", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		email.Sender = "jane@example.com"
+		email.MessageID = "welcome-42@example.com"
+
+		msg, err := email.ToSMTP()
+		require.NoError(t, err, "could not create smtp email")
+		require.Equal(t, "<welcome-42@example.com>", msg.Headers.Get("Message-Id"))
+		require.Empty(t, msg.Headers.Get("In-Reply-To"))
+		require.Empty(t, msg.Headers.Get("References"))
+	})
+}
@@ -0,0 +1,110 @@
+package commo
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// Inline images that are registered with a mailer and embedded in any email whose
+// html body references them with the cid template function.
+type inlineImages struct {
+	sync.RWMutex
+	images map[string]*Attachment
+}
+
+func newInlineImages() *inlineImages {
+	return &inlineImages{images: make(map[string]*Attachment)}
+}
+
+// Embed registers an inline image (e.g. a logo or an icon) with the mailer. Templates
+// reference the image with {{ cid "name" }} as the src of an img tag; when the html of
+// an email references the image it is embedded as a related part with the name as its
+// Content-ID. If the content type is empty it is detected from the name or the data.
+func (m *Mailer) Embed(name, contentType string, data []byte) {
+	m.images.Lock()
+	defer m.images.Unlock()
+	m.images.images[name] = &Attachment{Filename: name, ContentType: contentType, Data: data, Inline: true}
+}
+
+// EmbedFS registers all of the files in the file system that match the patterns as
+// inline images using the base name of each file as the name of the image.
+func (m *Mailer) EmbedFS(fsys fs.FS, patterns ...string) (err error) {
+	for _, pattern := range patterns {
+		var paths []string
+		if paths, err = fs.Glob(fsys, pattern); err != nil {
+			return err
+		}
+
+		for _, fpath := range paths {
+			var data []byte
+			if data, err = fs.ReadFile(fsys, fpath); err != nil {
+				return err
+			}
+			m.Embed(path.Base(fpath), "", data)
+		}
+	}
+	return nil
+}
+
+// Returns the registered images that are referenced by the html and are not already
+// attached to the email.
+func (m *Mailer) inline(html []byte, attached []*Attachment) (out []*Attachment) {
+	m.images.RLock()
+	defer m.images.RUnlock()
+
+	for name, image := range m.images.images {
+		if !references(html, name) || hasAttachment(attached, name) {
+			continue
+		}
+		out = append(out, image)
+	}
+	return out
+}
+
+// Embed registers an inline image with the default mailer; see [Mailer.Embed].
+func Embed(name, contentType string, data []byte) {
+	defaultMailer().Embed(name, contentType, data)
+}
+
+// EmbedFS registers inline images with the default mailer; see [Mailer.EmbedFS].
+func EmbedFS(fsys fs.FS, patterns ...string) error {
+	return defaultMailer().EmbedFS(fsys, patterns...)
+}
+
+// Returns the cid url of an inline image; marked as safe so that it is not sanitized
+// by html/template, which only allows http, https, and mailto urls.
+func cid(name string) template.URL {
+	return template.URL("cid:" + name)
+}
+
+// Characters that end a cid url in an html attribute or a css url().
+const cidTerminators = "\"')> \t\r\n"
+
+// Returns true if the html references the inline image with the specified name; the
+// whole url must match so that e.g. cid:logo does not match a reference to cid:logo.png.
+func references(html []byte, name string) bool {
+	ref := []byte(cid(name))
+	for {
+		i := bytes.Index(html, ref)
+		if i < 0 {
+			return false
+		}
+
+		html = html[i+len(ref):]
+		if len(html) > 0 && bytes.IndexByte([]byte(cidTerminators), html[0]) >= 0 {
+			return true
+		}
+	}
+}
+
+func hasAttachment(attachments []*Attachment, name string) bool {
+	for _, attachment := range attachments {
+		if attachment.Filename == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package commo_test
+
+import (
+	"embed"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+	"go.rtnl.ai/commo/commotest"
+)
+
+//go:embed testdata/images/*.png
+var images embed.FS
+
+func TestInlineImages(t *testing.T) {
+	mailer, err := commo.NewMailer(commo.Config{}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+	require.NoError(t, mailer.EmbedFS(images, "testdata/images/*.png"), "could not embed images")
+
+	logo, err := os.ReadFile("testdata/images/logo.png")
+	require.NoError(t, err, "could not read logo")
+
+	email, err := mailer.New("tess@example.com", "Inline Images", "inline_image", nil)
+	require.NoError(t, err, "could not create email")
+	email.Sender = "jane@example.com"
+	email.Attach("invoice.pdf", "", []byte("%PDF-1.7\n"))
+
+	t.Run("SMTP", func(t *testing.T) {
+		msg, err := email.ToSMTP()
+		require.NoError(t, err, "could not create smtp email")
+		require.Len(t, msg.Attachments, 2)
+		require.False(t, msg.Attachments[0].HTMLRelated)
+		require.True(t, msg.Attachments[1].HTMLRelated)
+
+		raw, err := msg.Bytes()
+		require.NoError(t, err, "could not render smtp email")
+		require.Contains(t, string(raw), "multipart/related")
+
+		parsed, err := commotest.ParseMessage(raw)
+		require.NoError(t, err, "could not parse smtp email")
+		require.Contains(t, parsed.HTML, `src="cid:logo.png"`)
+		require.Len(t, parsed.Attachments, 2)
+		require.Contains(t, parsed.Attachments, commotest.Attachment{
+			Filename: "logo.png", ContentType: "image/png", ContentID: "logo.png", Disposition: "inline", Content: logo,
+		})
+
+		// The registered image is not added to the email itself
+		require.Len(t, email.Attachments, 1)
+	})
+
+	t.Run("SendGrid", func(t *testing.T) {
+		msg, err := email.ToSendGrid()
+		require.NoError(t, err, "could not create sendgrid email")
+		require.Empty(t, commotest.ValidateSendGrid(msg))
+		require.Contains(t, msg.Content[1].Value, `src="cid:logo.png"`)
+		require.Len(t, msg.Attachments, 2)
+		require.Equal(t, "logo.png", msg.Attachments[1].Filename)
+		require.Equal(t, "image/png", msg.Attachments[1].Type)
+		require.Equal(t, "inline", msg.Attachments[1].Disposition)
+		require.Equal(t, "logo.png", msg.Attachments[1].ContentID)
+	})
+
+	t.Run("Unreferenced", func(t *testing.T) {
+		// Registered images are only embedded in emails that reference them
+		email, err := mailer.New("tess@example.com", "No Images", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		email.Sender = "jane@example.com"
+
+		msg, err := email.ToSMTP()
+		require.NoError(t, err, "could not create smtp email")
+		require.Empty(t, msg.Attachments)
+
+		sg, err := email.ToSendGrid()
+		require.NoError(t, err, "could not create sendgrid email")
+		require.Empty(t, sg.Attachments)
+	})
+
+	t.Run("Prefix", func(t *testing.T) {
+		// An image is only embedded if the whole cid url matches its name
+		mailer, err := commo.NewMailer(commo.Config{}, loadTestTemplates())
+		require.NoError(t, err, "could not create mailer")
+		mailer.Embed("logo", "image/png", logo)
+		mailer.Embed("logo.png", "image/png", logo)
+
+		email, err := mailer.New("tess@example.com", "Prefix", "inline_image", nil)
+		require.NoError(t, err, "could not create email")
+		email.Sender = "jane@example.com"
+
+		msg, err := email.ToSMTP()
+		require.NoError(t, err, "could not create smtp email")
+		require.Len(t, msg.Attachments, 1)
+		require.Equal(t, "logo.png", msg.Attachments[0].Filename)
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		// An inline attachment on the email takes precedence over a registered image
+		email, err := mailer.New("tess@example.com", "Override", "inline_image", nil)
+		require.NoError(t, err, "could not create email")
+		email.Sender = "jane@example.com"
+		email.Attach("logo.png", "image/png", []byte("\x89PNGcustom")).Inline = true
+
+		msg, err := email.ToSMTP()
+		require.NoError(t, err, "could not create smtp email")
+		require.Len(t, msg.Attachments, 1)
+		require.True(t, msg.Attachments[0].HTMLRelated)
+		require.Equal(t, []byte("\x89PNGcustom"), msg.Attachments[0].Content)
+	})
+}
+
+func TestInlineImagesInitialize(t *testing.T) {
+	logo, err := os.ReadFile("testdata/images/logo.png")
+	require.NoError(t, err, "could not read logo")
+
+	// Images registered before the package is initialized are carried over.
+	commo.Embed("logo.png", "image/png", logo)
+	require.NoError(t, commo.Initialize(commo.Config{Sender: "jane@example.com", Testing: true}, loadTestTemplates()))
+	t.Cleanup(func() { commo.Close() })
+
+	email, err := commo.New("tess@example.com", "Inline Images", "inline_image", nil)
+	require.NoError(t, err, "could not create email")
+
+	msg, err := email.ToSMTP()
+	require.NoError(t, err, "could not create smtp email")
+	require.Len(t, msg.Attachments, 1)
+	require.Equal(t, "logo.png", msg.Attachments[0].Filename)
+	require.True(t, msg.Attachments[0].HTMLRelated)
+}
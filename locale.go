@@ -0,0 +1,503 @@
+package commo
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NormalizeLocale returns the canonical form of a locale tag, e.g. fr_ca becomes fr-CA.
+func NormalizeLocale(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	if parts[0] == "" {
+		return ""
+	}
+
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i])
+		case 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Returns the locale followed by its less specific parents, e.g. zh-Hant-TW, zh-Hant,
+// and zh. The default locale (the empty string) is not included.
+func localeChain(locale string) (chain []string) {
+	locale = NormalizeLocale(locale)
+	for locale != "" {
+		chain = append(chain, locale)
+		i := strings.LastIndexByte(locale, '-')
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return chain
+}
+
+// Returns the language of the locale, e.g. fr for fr-CA.
+func language(locale string) string {
+	locale = NormalizeLocale(locale)
+	if i := strings.IndexByte(locale, '-'); i >= 0 {
+		return locale[:i]
+	}
+	return locale
+}
+
+// Returns true if the string looks like a locale tag, e.g. fr or fr-CA, so that it
+// can be distinguished from the rest of a template name.
+func isLocale(s string) bool {
+	parts := strings.Split(strings.ReplaceAll(s, "_", "-"), "-")
+	if len(parts[0]) < 2 || len(parts[0]) > 3 || !isAlpha(parts[0]) {
+		return false
+	}
+
+	for _, part := range parts[1:] {
+		if len(part) < 2 || len(part) > 8 {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(s string) bool {
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// Formatting conventions of a language.
+type conventions struct {
+	decimal        string
+	group          string
+	currencyBefore bool   // the currency symbol comes before the amount
+	currencySpace  string // separates the currency symbol and the amount
+	dates          map[string]string
+	months         [12]string
+	shortMonths    [12]string
+	weekdays       [7]string
+}
+
+// Date styles that can be passed to the date template function.
+const (
+	DateShort  = "short"
+	DateMedium = "medium"
+	DateLong   = "long"
+	DateFull   = "full"
+)
+
+var english = &conventions{
+	decimal: ".", group: ",", currencyBefore: true,
+	dates: map[string]string{
+		DateShort: "M/d/yyyy", DateMedium: "MMM d, yyyy", DateLong: "MMMM d, yyyy", DateFull: "EEEE, MMMM d, yyyy",
+	},
+	months:      [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+	shortMonths: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+	weekdays:    [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+}
+
+// Formatting conventions by language; languages that are not listed use english.
+var localeConventions = map[string]*conventions{
+	"en": english,
+	"de": {
+		decimal: ",", group: ".", currencySpace: "\u00a0",
+		dates: map[string]string{
+			DateShort: "dd.MM.yyyy", DateMedium: "dd.MM.yyyy", DateLong: "d. MMMM yyyy", DateFull: "EEEE, d. MMMM yyyy",
+		},
+		months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		weekdays:    [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+	},
+	"es": {
+		decimal: ",", group: ".", currencySpace: "\u00a0",
+		dates: map[string]string{
+			DateShort: "d/M/yyyy", DateMedium: "d MMM yyyy", DateLong: "d 'de' MMMM 'de' yyyy", DateFull: "EEEE, d 'de' MMMM 'de' yyyy",
+		},
+		months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		weekdays:    [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+	},
+	"fr": {
+		decimal: ",", group: "\u202f", currencySpace: "\u00a0",
+		dates: map[string]string{
+			DateShort: "dd/MM/yyyy", DateMedium: "d MMM yyyy", DateLong: "d MMMM yyyy", DateFull: "EEEE d MMMM yyyy",
+		},
+		months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		weekdays:    [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+	},
+	"it": {
+		decimal: ",", group: ".", currencySpace: "\u00a0",
+		dates: map[string]string{
+			DateShort: "dd/MM/yyyy", DateMedium: "d MMM yyyy", DateLong: "d MMMM yyyy", DateFull: "EEEE d MMMM yyyy",
+		},
+		months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		shortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		weekdays:    [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+	},
+	"ja": {
+		decimal: ".", group: ",", currencyBefore: true,
+		dates: map[string]string{
+			DateShort: "yyyy/MM/dd", DateMedium: "yyyy/MM/dd", DateLong: "yyyy年M月d日", DateFull: "yyyy年M月d日EEEE",
+		},
+		months:      [12]string{"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+		shortMonths: [12]string{"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+		weekdays:    [7]string{"日曜日", "月曜日", "火曜日", "水曜日", "木曜日", "金曜日", "土曜日"},
+	},
+	"nl": {
+		decimal: ",", group: ".", currencyBefore: true, currencySpace: "\u00a0",
+		dates: map[string]string{
+			DateShort: "dd-MM-yyyy", DateMedium: "d MMM yyyy", DateLong: "d MMMM yyyy", DateFull: "EEEE d MMMM yyyy",
+		},
+		months:      [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		weekdays:    [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+	},
+	"pt": {
+		decimal: ",", group: ".", currencySpace: "\u00a0",
+		dates: map[string]string{
+			DateShort: "dd/MM/yyyy", DateMedium: "d 'de' MMM 'de' yyyy", DateLong: "d 'de' MMMM 'de' yyyy", DateFull: "EEEE, d 'de' MMMM 'de' yyyy",
+		},
+		months:      [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		shortMonths: [12]string{"jan.", "fev.", "mar.", "abr.", "mai.", "jun.", "jul.", "ago.", "set.", "out.", "nov.", "dez."},
+		weekdays:    [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+	},
+}
+
+// Region specific overrides of the conventions of a language.
+var regionConventions = map[string]func(conventions) conventions{
+	"en-GB": func(c conventions) conventions {
+		c.dates = map[string]string{
+			DateShort: "dd/MM/yyyy", DateMedium: "d MMM yyyy", DateLong: "d MMMM yyyy", DateFull: "EEEE d MMMM yyyy",
+		}
+		return c
+	},
+	"fr-CA": func(c conventions) conventions {
+		c.group = "\u00a0"
+		c.dates = map[string]string{
+			DateShort: "yyyy-MM-dd", DateMedium: "d MMM yyyy", DateLong: "d MMMM yyyy", DateFull: "EEEE d MMMM yyyy",
+		}
+		return c
+	},
+	"de-CH": func(c conventions) conventions {
+		c.group = "\u2019"
+		c.decimal = "."
+		return c
+	},
+}
+
+// Returns the formatting conventions of the locale.
+func conventionsFor(locale string) *conventions {
+	c, ok := localeConventions[language(locale)]
+	if !ok {
+		c = english
+	}
+
+	for _, tag := range localeChain(locale) {
+		if override, ok := regionConventions[tag]; ok {
+			oc := override(*c)
+			return &oc
+		}
+	}
+	return c
+}
+
+// Currency symbols for common currencies; other currencies use their ISO code.
+var currencySymbols = map[string]string{
+	"AUD": "A$", "BRL": "R$", "CAD": "CA$", "CHF": "CHF", "CNY": "CN¥", "EUR": "€", "GBP": "£",
+	"INR": "₹", "JPY": "¥", "KRW": "₩", "MXN": "MX$", "NZD": "NZ$", "USD": "$",
+}
+
+// Currencies that do not have minor units.
+var zeroDecimalCurrencies = map[string]bool{"JPY": true, "KRW": true, "VND": true, "CLP": true, "ISK": true}
+
+// Format an integer with the grouping separator of the locale.
+func (c *conventions) formatInt(i int64) string {
+	s := strconv.FormatInt(i, 10)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	var sb strings.Builder
+	if neg {
+		sb.WriteByte('-')
+	}
+
+	for i, d := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			sb.WriteString(c.group)
+		}
+		sb.WriteRune(d)
+	}
+	return sb.String()
+}
+
+// Format a float with the grouping and decimal separators of the locale; if decimals is
+// negative the minimum number of decimals needed to represent the value is used.
+func (c *conventions) formatFloat(f float64, decimals int) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	s := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	whole, frac, _ := strings.Cut(s, ".")
+
+	n, _ := strconv.ParseInt(whole, 10, 64)
+	out := c.formatInt(n)
+	if frac != "" {
+		out += c.decimal + frac
+	}
+
+	if f < 0 && strings.Trim(s, "0.") != "" {
+		out = "-" + out
+	}
+	return out
+}
+
+// Format a date using a date style or a pattern of CLDR date symbols (d, dd, M, MM,
+// MMM, MMMM, yy, yyyy, EEEE, and quoted literals); any other layout is treated as a
+// Go time layout.
+func (c *conventions) formatDate(t time.Time, style string) string {
+	pattern, ok := c.dates[style]
+	if !ok {
+		return t.Format(style)
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(pattern); {
+		ch := pattern[i]
+		if ch == '\'' {
+			end := strings.IndexByte(pattern[i+1:], '\'')
+			if end < 0 {
+				sb.WriteString(pattern[i+1:])
+				break
+			}
+			sb.WriteString(pattern[i+1 : i+1+end])
+			i += end + 2
+			continue
+		}
+
+		n := 1
+		for i+n < len(pattern) && pattern[i+n] == ch {
+			n++
+		}
+
+		switch {
+		case ch == 'd' && n == 1:
+			sb.WriteString(strconv.Itoa(t.Day()))
+		case ch == 'd':
+			fmt.Fprintf(&sb, "%02d", t.Day())
+		case ch == 'M' && n == 1:
+			sb.WriteString(strconv.Itoa(int(t.Month())))
+		case ch == 'M' && n == 2:
+			fmt.Fprintf(&sb, "%02d", int(t.Month()))
+		case ch == 'M' && n == 3:
+			sb.WriteString(c.shortMonths[t.Month()-1])
+		case ch == 'M':
+			sb.WriteString(c.months[t.Month()-1])
+		case ch == 'y' && n == 2:
+			fmt.Fprintf(&sb, "%02d", t.Year()%100)
+		case ch == 'y':
+			sb.WriteString(strconv.Itoa(t.Year()))
+		case ch == 'E':
+			sb.WriteString(c.weekdays[t.Weekday()])
+		default:
+			sb.WriteString(pattern[i : i+n])
+		}
+		i += n
+	}
+	return sb.String()
+}
+
+// Returns the locale aware formatting and translation functions for templates.
+func localeFuncs(locale string, catalogs *catalogs) template.FuncMap {
+	conv := conventionsFor(locale)
+	return template.FuncMap{
+		"locale": func() string {
+			return locale
+		},
+		"t": func(msgid string, args ...any) string {
+			msg := catalogs.translate(locale, msgid)
+			if len(args) > 0 {
+				return fmt.Sprintf(msg, args...)
+			}
+			return msg
+		},
+		"plural": func(singular, plural string, n any, args ...any) (string, error) {
+			count, err := toInt(n)
+			if err != nil {
+				return "", err
+			}
+
+			msg := catalogs.plural(locale, singular, plural, count)
+			if strings.Contains(msg, "%") {
+				return fmt.Sprintf(msg, append([]any{count}, args...)...), nil
+			}
+			return msg, nil
+		},
+		"date": func(style string, value any, tz ...string) (string, error) {
+			t, err := toTime(value)
+			if err != nil || t.IsZero() {
+				return "", err
+			}
+
+			if len(tz) > 0 {
+				var loc *time.Location
+				if loc, err = time.LoadLocation(tz[0]); err != nil {
+					return "", err
+				}
+				t = t.In(loc)
+			}
+			return conv.formatDate(t, style), nil
+		},
+		"duration": func(value any) (string, error) {
+			d, err := toDuration(value)
+			if err != nil {
+				return "", err
+			}
+
+			n, singular, plural := humanize(d)
+			return fmt.Sprintf(catalogs.plural(locale, singular, plural, n), n), nil
+		},
+		"number": func(value any) (string, error) {
+			return formatNumber(conv, value, -1)
+		},
+		"currency": func(code string, value any) (string, error) {
+			code = strings.ToUpper(code)
+			decimals := 2
+			if zeroDecimalCurrencies[code] {
+				decimals = 0
+			}
+
+			amount, err := formatNumber(conv, value, decimals)
+			if err != nil {
+				return "", err
+			}
+
+			symbol, ok := currencySymbols[code]
+			if !ok {
+				symbol = code
+			}
+
+			neg := strings.HasPrefix(amount, "-")
+			amount = strings.TrimPrefix(amount, "-")
+			if conv.currencyBefore {
+				amount = symbol + conv.currencySpace + amount
+			} else {
+				amount = amount + conv.currencySpace + symbol
+			}
+
+			if neg {
+				amount = "-" + amount
+			}
+			return amount, nil
+		},
+	}
+}
+
+func formatNumber(conv *conventions, value any, decimals int) (string, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if decimals > 0 {
+			return conv.formatFloat(float64(v.Int()), decimals), nil
+		}
+		return conv.formatInt(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if decimals > 0 {
+			return conv.formatFloat(float64(v.Uint()), decimals), nil
+		}
+		return conv.formatInt(int64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return conv.formatFloat(v.Float(), decimals), nil
+	case reflect.String:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return "", fmt.Errorf("could not format %q as a number", v.String())
+		}
+		return conv.formatFloat(f, decimals), nil
+	default:
+		return "", fmt.Errorf("could not format %T as a number", value)
+	}
+}
+
+func toInt(value any) (int, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int(v.Float()), nil
+	default:
+		return 0, fmt.Errorf("could not use %T as a count", value)
+	}
+}
+
+func toTime(value any) (time.Time, error) {
+	switch t := value.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		if t == nil {
+			return time.Time{}, nil
+		}
+		return *t, nil
+	case nil:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, fmt.Errorf("could not format %T as a date", value)
+	}
+}
+
+func toDuration(value any) (time.Duration, error) {
+	switch d := value.(type) {
+	case time.Duration:
+		return d, nil
+	case string:
+		return time.ParseDuration(d)
+	default:
+		return 0, fmt.Errorf("could not format %T as a duration", value)
+	}
+}
+
+// Units of humanized durations and the messages that are translated by the catalogs.
+var durationUnits = []struct {
+	unit     time.Duration
+	singular string
+	plural   string
+}{
+	{24 * time.Hour, "%d day", "%d days"},
+	{time.Hour, "%d hour", "%d hours"},
+	{time.Minute, "%d minute", "%d minutes"},
+	{time.Second, "%d second", "%d seconds"},
+}
+
+// Rounds the duration to the largest unit that it is at least one of, e.g. 90 minutes
+// is 2 hours, returning the count and the singular and plural messages of the unit.
+func humanize(d time.Duration) (int, string, string) {
+	if d < 0 {
+		d = -d
+	}
+
+	for _, u := range durationUnits {
+		if d >= u.unit {
+			return int(d.Round(u.unit) / u.unit), u.singular, u.plural
+		}
+	}
+
+	last := durationUnits[len(durationUnits)-1]
+	return 0, last.singular, last.plural
+}
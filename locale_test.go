@@ -0,0 +1,230 @@
+package commo_test
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	testCases := []struct {
+		locale   string
+		expected string
+	}{
+		{"", ""},
+		{"fr", "fr"},
+		{"FR", "fr"},
+		{"fr_ca", "fr-CA"},
+		{"fr-ca", "fr-CA"},
+		{" en-GB ", "en-GB"},
+		{"zh_hant_tw", "zh-Hant-TW"},
+	}
+
+	for i, tc := range testCases {
+		require.Equal(t, tc.expected, commo.NormalizeLocale(tc.locale), "test case %d failed", i)
+	}
+}
+
+func TestLocalizedTemplates(t *testing.T) {
+	fsys := fstest.MapFS{
+		"welcome.html":       {Data: []byte(`<p>{{ t "Welcome, %s!" .Name }}</p>`)},
+		"welcome.txt":        {Data: []byte(`{{ t "Welcome, %s!" .Name }}`)},
+		"welcome.fr.html":    {Data: []byte(`<p>Salut {{ .Name }} !</p>`)},
+		"welcome.fr.txt":     {Data: []byte(`Salut {{ .Name }} !`)},
+		"welcome.fr-CA.html": {Data: []byte(`<p>Allô {{ .Name }} !</p>`)},
+		"welcome.fr-CA.txt":  {Data: []byte(`Allô {{ .Name }} !`)},
+		"locales/de.json":    {Data: []byte(`{"Welcome, %s!": "Willkommen, %s!"}`)},
+		"locales/es.po":      {Data: []byte("msgid \"Welcome, %s!\"\nmsgstr \"¡Bienvenido, %s!\"\n")},
+	}
+
+	// The locales of the localized templates without a catalog must be listed.
+	templates, err := commo.LoadTemplates(fsys, commo.Layout{Locales: []string{"fr", "fr-CA"}})
+	require.NoError(t, err, "could not load localized templates")
+	require.Equal(t, []string{"welcome"}, templates.Names())
+	require.Equal(t, []string{"de", "es", "fr", "fr-CA"}, templates.Locales())
+
+	mailer, err := commo.NewMailer(commo.Config{}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	testCases := []struct {
+		locale   string
+		expected string
+	}{
+		{"", "Welcome, Jane!"},
+		{"en-US", "Welcome, Jane!"},
+		{"fr", "Salut Jane !"},
+		{"fr-BE", "Salut Jane !"},
+		{"fr_CA", "Allô Jane !"},
+		{"de-AT", "Willkommen, Jane!"},
+		{"es", "¡Bienvenido, Jane!"},
+	}
+
+	data := struct{ Name string }{"Jane"}
+	for i, tc := range testCases {
+		localized := mailer.Localized(tc.locale)
+		text, html, err := localized.Render("welcome", data)
+		require.NoError(t, err, "test case %d errored", i)
+		require.Equal(t, tc.expected, string(text), "test case %d failed", i)
+		require.Equal(t, "<p>"+tc.expected+"</p>", string(html), "test case %d failed", i)
+	}
+
+	t.Run("Email", func(t *testing.T) {
+		email, err := mailer.Localized("fr-CA").New("jane@example.com", "Bienvenue", "welcome", data)
+		require.NoError(t, err, "could not create email")
+		require.Equal(t, "fr-CA", email.Locale)
+		email.Sender = "admin@example.com"
+
+		msg, err := email.ToSMTP()
+		require.NoError(t, err, "could not create smtp email")
+		require.Equal(t, "Allô Jane !", string(msg.Text))
+
+		// The locale of the email can be changed after it is created.
+		email.Locale = "de"
+		sg, err := email.ToSendGrid()
+		require.NoError(t, err, "could not create sendgrid email")
+		require.Equal(t, "Willkommen, Jane!", sg.Content[0].Value)
+	})
+}
+
+func TestDottedTemplateNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"invite.new.html": {Data: []byte(`<p>New invite</p>`)},
+		"invite.new.txt":  {Data: []byte(`New invite`)},
+		"report.old.html": {Data: []byte(`<p>Old report</p>`)},
+		"report.old.txt":  {Data: []byte(`Old report`)},
+		"welcome.html":    {Data: []byte(`<p>Welcome</p>`)},
+		"welcome.txt":     {Data: []byte(`Welcome`)},
+		"welcome.de.html": {Data: []byte(`<p>Willkommen</p>`)},
+		"welcome.de.txt":  {Data: []byte(`Willkommen`)},
+		"locales/de.json": {Data: []byte(`{}`)},
+	}
+
+	// Dotted suffixes that are not supported locales are part of the template name.
+	templates, err := commo.LoadTemplates(fsys, commo.DefaultLayout)
+	require.NoError(t, err, "could not load templates")
+	require.Equal(t, []string{"invite.new", "report.old", "welcome"}, templates.Names())
+	require.Equal(t, []string{"de"}, templates.Locales())
+
+	mailer, err := commo.NewMailer(commo.Config{}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	text, _, err := mailer.Render("invite.new", nil)
+	require.NoError(t, err, "could not render dotted template")
+	require.Equal(t, "New invite", string(text))
+
+	text, _, err = mailer.Localized("de").Render("report.old", nil)
+	require.NoError(t, err, "could not render dotted template in a locale")
+	require.Equal(t, "Old report", string(text))
+
+	text, _, err = mailer.Localized("de").Render("welcome", nil)
+	require.NoError(t, err, "could not render localized template")
+	require.Equal(t, "Willkommen", string(text))
+
+	// Rendering in an unsupported locale does not select a dotted template.
+	text, _, err = mailer.Localized("new").Render("invite", nil)
+	require.ErrorIs(t, err, commo.ErrTemplateNotFound)
+}
+
+func TestPlural(t *testing.T) {
+	fsys := fstest.MapFS{
+		"cart.html": {Data: []byte(`{{ plural "%d item" "%d items" .Count }}`)},
+		"cart.txt":  {Data: []byte(`{{ plural "%d item" "%d items" .Count }}`)},
+		"locales/fr.json": {Data: []byte(`{
+			"%d item": {"one": "%d article", "other": "%d articles"}
+		}`)},
+		"locales/pl.po": {Data: []byte(`msgid ""
+msgstr ""
+"Plural-Forms: nplurals=3; plural=(n==1 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);\n"
+
+msgid "%d item"
+msgid_plural "%d items"
+msgstr[0] "%d przedmiot"
+msgstr[1] "%d przedmioty"
+msgstr[2] "%d przedmiotów"
+`)},
+	}
+
+	templates, err := commo.LoadTemplates(fsys, commo.DefaultLayout)
+	require.NoError(t, err, "could not load templates")
+
+	mailer, err := commo.NewMailer(commo.Config{}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	testCases := []struct {
+		locale   string
+		count    int
+		expected string
+	}{
+		{"", 1, "1 item"},
+		{"", 0, "0 items"},
+		{"fr", 0, "0 article"},
+		{"fr", 1, "1 article"},
+		{"fr", 2, "2 articles"},
+		{"pl", 1, "1 przedmiot"},
+		{"pl", 3, "3 przedmioty"},
+		{"pl", 5, "5 przedmiotów"},
+		{"pl", 22, "22 przedmioty"},
+		{"pl", 12, "12 przedmiotów"},
+	}
+
+	for i, tc := range testCases {
+		text, _, err := mailer.Localized(tc.locale).Render("cart", struct{ Count int }{tc.count})
+		require.NoError(t, err, "test case %d errored", i)
+		require.Equal(t, tc.expected, string(text), "test case %d failed", i)
+	}
+}
+
+func TestLocaleFormatting(t *testing.T) {
+	fsys := fstest.MapFS{
+		"receipt.html": {Data: []byte(`{{ date "long" .Date }}|{{ date "short" .Date }}|{{ number .Count }}|{{ currency .Code .Total }}`)},
+		"receipt.txt":  {Data: []byte(`{{ locale }}`)},
+	}
+
+	templates, err := commo.LoadTemplates(fsys, commo.Layout{Locales: []string{"en-GB", "de", "fr", "fr-CA", "ja"}})
+	require.NoError(t, err, "could not load templates")
+
+	mailer, err := commo.NewMailer(commo.Config{}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	date := time.Date(2025, time.March, 7, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		locale   string
+		code     string
+		total    float64
+		expected string
+	}{
+		{"", "USD", 1234.5, "March 7, 2025|3/7/2025|1,234,567|$1,234.50"},
+		{"en-GB", "GBP", 1234.5, "7 March 2025|07/03/2025|1,234,567|£1,234.50"},
+		{"de", "EUR", -1234.5, "7. März 2025|07.03.2025|1.234.567|-1.234,50\u00a0€"},
+		{"fr", "EUR", 1234.5, "7 mars 2025|07/03/2025|1\u202f234\u202f567|1\u202f234,50\u00a0€"},
+		{"fr-CA", "CAD", 1234.5, "7 mars 2025|2025-03-07|1\u00a0234\u00a0567|1\u00a0234,50\u00a0CA$"},
+		{"ja", "JPY", 1234, "2025年3月7日|2025/03/07|1,234,567|¥1,234"},
+	}
+
+	for i, tc := range testCases {
+		data := map[string]any{"Date": date, "Count": 1234567, "Code": tc.code, "Total": tc.total}
+		text, html, err := mailer.Localized(tc.locale).Render("receipt", data)
+		require.NoError(t, err, "test case %d errored", i)
+		require.Equal(t, commo.NormalizeLocale(tc.locale), string(text), "test case %d failed", i)
+		require.Equal(t, tc.expected, string(html), "test case %d failed", i)
+	}
+}
+
+func TestInvalidCatalog(t *testing.T) {
+	testCases := []fstest.MapFS{
+		{"locales/french.json": {Data: []byte(`{}`)}},
+		{"locales/fr.json": {Data: []byte(`["Bienvenue"]`)}},
+		{"locales/fr.po": {Data: []byte("msgid \"Welcome\"\nmsgstr[x] \"Bienvenue\"\n")}},
+	}
+
+	for i, fsys := range testCases {
+		fsys["welcome.html"] = &fstest.MapFile{Data: []byte(`{{ t "Welcome" }}`)}
+		fsys["welcome.txt"] = &fstest.MapFile{Data: []byte(`{{ t "Welcome" }}`)}
+
+		_, err := commo.LoadTemplates(fsys, commo.DefaultLayout)
+		require.ErrorIs(t, err, commo.ErrInvalidCatalog, "test case %d failed", i)
+	}
+}
@@ -0,0 +1,262 @@
+package commo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.rtnl.ai/x/backoff"
+)
+
+// Mailer renders and sends emails using its own configuration, templates, and
+// backend. Multiple mailers can be used in the same process, e.g. to send emails
+// from different sender identities. The package level functions use a default
+// Mailer that is configured by Initialize.
+type Mailer struct {
+	conf    Config
+	templs  *Templates
+	images  *inlineImages
+	backend Backend
+	locale  string
+}
+
+// NewMailer creates a Mailer that sends emails using the backend described by the
+// configuration, or a MockBackend if the configuration is in testing mode. If there is
+// no valid email configuration available then the Mailer can still render emails but
+// will return ErrNotInitialized when sending. If the configuration is strict, the
+// templates are set to fail on missing keys; since templates are not copied, this
+// also affects other mailers that use the same templates.
+func NewMailer(conf Config, templates *Templates) (_ *Mailer, err error) {
+	if !conf.Available() && !conf.Testing {
+		return &Mailer{conf: conf, templs: strict(conf, templates), images: newInlineImages()}, nil
+	}
+
+	if err = conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	var b Backend
+	if b, err = newBackend(conf); err != nil {
+		return nil, err
+	}
+
+	return NewMailerWithBackend(conf, b, templates)
+}
+
+// NewMailerWithBackend creates a Mailer that sends emails using the specified backend
+// rather than the backend described by the configuration. The configuration is still
+// used for the default sender and the retry behavior of Send; durations of the backoff
+// configuration that are not set use the same defaults as the environment.
+func NewMailerWithBackend(conf Config, b Backend, templates *Templates) (_ *Mailer, err error) {
+	if b == nil {
+		return nil, ErrNoBackend
+	}
+
+	if err = conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	// The backoff is validated even if the configuration is not, since a custom
+	// backend does not make the configuration available.
+	conf.Backoff = conf.Backoff.withDefaults()
+	if err = conf.Backoff.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Mailer{conf: conf, templs: strict(conf, templates), images: newInlineImages(), backend: b}, nil
+}
+
+// Sets missingkey=error on the templates if the configuration is strict so that keys
+// that are missing from map data fail to render rather than rendering <no value>.
+func strict(conf Config, templates *Templates) *Templates {
+	if conf.Strict && templates != nil {
+		templates.Option("missingkey=error")
+	}
+	return templates
+}
+
+// New creates a new email with the configured sender of the mailer attached. The
+// email is bound to the mailer so that calling Send on the email uses this mailer.
+// If the template declares metadata blocks, the subject is rendered from the data when
+// it is empty and the tags of the template are used. The sender of the template is only
+// used if the mailer has no configured sender or if Config.TemplateSender is set.
+func (m *Mailer) New(recipient, subject, template string, data any) (msg *Email, err error) {
+	if msg, err = m.create(recipient, subject, template, data); err != nil {
+		return nil, err
+	}
+
+	msg.mailer = m
+	return msg, nil
+}
+
+func (m *Mailer) create(recipient, subject, template string, data any) (_ *Email, err error) {
+	msg := &Email{
+		Sender:   m.conf.Sender,
+		To:       []string{recipient},
+		Subject:  subject,
+		Template: template,
+		Data:     data,
+		Locale:   m.locale,
+	}
+
+	// Templates may not be loaded yet or the template may not exist; in that case
+	// the error is returned when the email is rendered.
+	if m.templs == nil {
+		return msg, nil
+	}
+
+	if set, name := m.templs.resolve(template, m.locale); set.HTML[name] == nil {
+		return msg, nil
+	}
+
+	var meta *Metadata
+	if meta, err = m.RenderMetadata(template, data); err != nil {
+		return nil, fmt.Errorf("could not render metadata for %q: %w", template, err)
+	}
+
+	if msg.Subject == "" {
+		msg.Subject = meta.Subject
+	}
+
+	if meta.Sender != "" && (msg.Sender == "" || m.conf.TemplateSender) {
+		msg.Sender = meta.Sender
+	}
+
+	msg.Tags = meta.Tags
+	return msg, nil
+}
+
+// Localized returns a mailer that shares the configuration, templates, inline images,
+// and backend of the mailer but that renders emails in the specified locale, e.g.
+// fr-CA. Emails created by the localized mailer have their Locale set. Closing the
+// localized mailer closes the shared backend.
+func (m *Mailer) Localized(locale string) *Mailer {
+	localized := *m
+	localized.locale = NormalizeLocale(locale)
+	return &localized
+}
+
+// Locale returns the locale that the mailer renders emails in; the empty string is the
+// default locale of the templates.
+func (m *Mailer) Locale() string {
+	return m.locale
+}
+
+// Send an email using the backend of the mailer. Uses exponential backoff to retry
+// multiple times on error with an increasing delay between attempts.
+func (m *Mailer) Send(email *Email) error {
+	return m.SendContext(context.Background(), email)
+}
+
+// SendContext sends an email using the backend of the mailer like Send, but stops
+// retrying as soon as the context is cancelled or its deadline is exceeded. The context
+// is also passed to the backend to cancel the delivery attempt in progress. If the email
+// was not sent because the context is done, the error wraps ctx.Err().
+//
+// The email is validated and rendered once before it is delivered (see Prepare), so
+// validation and rendering errors are returned without any delivery attempts and
+// retries deliver the same message even if the templates are reloaded.
+func (m *Mailer) SendContext(ctx context.Context, email *Email) (err error) {
+	// The mailer must have a backend to send.
+	if m.backend == nil {
+		return ErrNotInitialized
+	}
+
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("email was not sent: %w", err)
+	}
+
+	var msg *Message
+	if msg, err = m.prepare(email); err != nil {
+		return err
+	}
+	return m.send(ctx, msg)
+}
+
+// SendMessage delivers a prepared message using the backend of the mailer, retrying
+// like SendContext. The message may have been prepared by a different mailer or
+// restored from storage.
+func (m *Mailer) SendMessage(ctx context.Context, msg *Message) (err error) {
+	if m.backend == nil {
+		return ErrNotInitialized
+	}
+
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("email was not sent: %w", err)
+	}
+	return m.send(ctx, msg)
+}
+
+// Deliver the message with multiple retries; the error of the last attempt is kept
+// since the retry loop returns the context error when it is cancelled. Errors that will
+// not succeed if retried (e.g. a bad address) are returned immediately and if the
+// provider asks to wait (e.g. when rate limited) the next attempt waits at least that
+// long, unless the wait would exceed the maximum elapsed time.
+func (m *Mailer) send(ctx context.Context, msg *Message) (err error) {
+	exponential := backoff.ExponentialBackOff{
+		InitialInterval:     m.conf.Backoff.InitialInterval,
+		RandomizationFactor: randomizationFactor,
+		Multiplier:          multiplier,
+		MaxInterval:         m.conf.Backoff.MaxInterval,
+	}
+
+	var last error
+	if _, err = backoff.Retry(ctx, func() (any, serr error) {
+		if last = m.backend.Send(ctx, msg); last != nil {
+			if !Retryable(last) {
+				return nil, Permanent(last)
+			}
+
+			var derr *DeliveryError
+			if errors.As(last, &derr) && derr.RetryAfter > 0 {
+				return nil, &backoff.RetryAfterError{Duration: derr.RetryAfter}
+			}
+		}
+		return nil, last
+	},
+		backoff.WithBackOff(&exponential),
+		backoff.WithMaxElapsedTime(m.conf.Backoff.MaxElapsedTime),
+	); err != nil {
+		if cerr := ctx.Err(); cerr != nil {
+			if last == nil || errors.Is(last, cerr) {
+				return fmt.Errorf("email was not sent: %w", cerr)
+			}
+			return fmt.Errorf("email was not sent: %w (last attempt: %w)", cerr, last)
+		}
+
+		// The retry loop returns the wait rather than the error of the provider.
+		var wait *backoff.RetryAfterError
+		if errors.As(err, &wait) {
+			return last
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Backend returns the backend used by the mailer to send emails, or nil if the mailer
+// cannot send emails.
+func (m *Mailer) Backend() Backend {
+	return m.backend
+}
+
+// Templates returns the templates that the mailer renders emails with, or nil if the
+// templates have not been loaded.
+func (m *Mailer) Templates() *Templates {
+	return m.templs
+}
+
+// Mock returns the mock backend of the mailer if it is in testing mode, otherwise nil.
+func (m *Mailer) Mock() *MockBackend {
+	mock, _ := m.backend.(*MockBackend)
+	return mock
+}
+
+// Close the backend of the mailer; the mailer cannot send emails after it is closed.
+func (m *Mailer) Close() error {
+	if m.backend == nil {
+		return nil
+	}
+	return m.backend.Close()
+}
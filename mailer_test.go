@@ -0,0 +1,167 @@
+package commo_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+func TestMailer(t *testing.T) {
+	t.Parallel()
+
+	conf := func(sender string) commo.Config {
+		return commo.Config{
+			Sender:  sender,
+			Backoff: fastBackoff(),
+		}
+	}
+
+	transactional := &recordingBackend{}
+	tm, err := commo.NewMailerWithBackend(conf("Transactions <billing@example.com>"), transactional, loadTestTemplates())
+	require.NoError(t, err, "could not create transactional mailer")
+
+	marketing := &recordingBackend{}
+	mm, err := commo.NewMailerWithBackend(conf("Marketing <news@example.com>"), marketing, loadTestTemplates())
+	require.NoError(t, err, "could not create marketing mailer")
+
+	email, err := tm.New("test@example.com", "Your Invoice", "test_email", nil)
+	require.NoError(t, err, "could not create transactional email")
+	require.Equal(t, "Transactions <billing@example.com>", email.Sender)
+	require.NoError(t, email.Send(), "could not send transactional email")
+
+	email, err = mm.New("test@example.com", "Our Newsletter", "test_email", nil)
+	require.NoError(t, err, "could not create marketing email")
+	require.Equal(t, "Marketing <news@example.com>", email.Sender)
+	require.NoError(t, email.Send(), "could not send marketing email")
+
+	require.Len(t, transactional.sent, 1)
+	require.Equal(t, "Your Invoice", transactional.sent[0].Subject())
+	require.Len(t, marketing.sent, 1)
+	require.Equal(t, "Our Newsletter", marketing.sent[0].Subject())
+
+	// An email is rendered with the templates of the mailer that sends it.
+	templates, err := commo.LoadTemplates(fstest.MapFS{
+		"test_email.html": {Data: []byte(`<p>Marketing</p>`)},
+		"test_email.txt":  {Data: []byte(`Marketing`)},
+	}, commo.DefaultLayout)
+	require.NoError(t, err, "could not load templates")
+
+	email, err = tm.New("test@example.com", "Your Invoice", "test_email", nil)
+	require.NoError(t, err, "could not create transactional email")
+
+	branded, err := commo.NewMailerWithBackend(conf("Marketing <news@example.com>"), marketing, templates)
+	require.NoError(t, err, "could not create branded mailer")
+	require.NoError(t, branded.Send(email), "could not send transactional email with branded mailer")
+	require.Len(t, marketing.sent, 2)
+	require.Equal(t, []byte("Marketing"), marketing.sent[1].Text())
+
+	text, html, err := tm.Render("test_email", struct{ ContactName string }{"Tess Tester"})
+	require.NoError(t, err, "could not render email")
+	require.Contains(t, string(text), "Tess Tester")
+	require.Contains(t, string(html), "Tess Tester")
+
+	require.NoError(t, tm.Close())
+	require.NoError(t, mm.Close())
+}
+
+func TestMailerNotAvailable(t *testing.T) {
+	t.Parallel()
+
+	m, err := commo.NewMailer(commo.Config{}, loadTestTemplates())
+	require.NoError(t, err, "expected no error when config is not available")
+
+	email, err := m.New("test@example.com", "Test Subject", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+	require.ErrorIs(t, email.Send(), commo.ErrNotInitialized)
+
+	_, _, err = m.Render("test_email", nil)
+	require.NoError(t, err, "mailer should be able to render without a backend")
+	require.NoError(t, m.Close())
+}
+
+func TestMailerSendContext(t *testing.T) {
+	t.Parallel()
+
+	// The retries must be stopped by the context rather than the maximum elapsed time.
+	conf := commo.Config{Sender: "test@example.com", Backoff: fastBackoff()}
+	conf.Backoff.MaxElapsedTime = time.Minute
+
+	t.Run("Cancelled", func(t *testing.T) {
+		backend := &recordingBackend{}
+		m, err := commo.NewMailerWithBackend(conf, backend, loadTestTemplates())
+		require.NoError(t, err, "could not create mailer")
+
+		email, err := m.New("test@example.com", "Test Subject", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		require.ErrorIs(t, email.SendContext(ctx), context.Canceled)
+		require.Zero(t, backend.calls, "expected no attempts after the context is cancelled")
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		backend := &recordingBackend{fails: 1 << 30}
+		m, err := commo.NewMailerWithBackend(conf, backend, loadTestTemplates())
+		require.NoError(t, err, "could not create mailer")
+
+		email, err := m.New("test@example.com", "Test Subject", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err = m.SendContext(ctx, email)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.ErrorContains(t, err, "transient failure")
+		require.Less(t, time.Since(start), time.Second, "expected retries to stop at the deadline")
+		require.Greater(t, backend.calls, 1, "expected send to be retried until the deadline")
+		require.Empty(t, backend.sent)
+	})
+}
+
+func TestMailerBackoffDefaults(t *testing.T) {
+	t.Parallel()
+
+	// A configuration without a backend does not validate the backoff, so a mailer with
+	// a custom backend must not retry without a delay.
+	backend := &recordingBackend{fails: 1 << 30}
+	m, err := commo.NewMailerWithBackend(commo.Config{Sender: "test@example.com"}, backend, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	email, err := m.New("test@example.com", "Test Subject", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, m.SendContext(ctx, email), context.DeadlineExceeded)
+	require.Equal(t, 1, backend.calls, "expected the default initial interval before a retry")
+
+	_, err = commo.NewMailerWithBackend(commo.Config{Backoff: commo.BackoffConfig{Timeout: -1}}, backend, loadTestTemplates())
+	require.ErrorIs(t, err, commo.ErrConfigTimeout)
+}
+
+// Returns a backoff configuration that retries quickly so that tests of the retry
+// behavior do not wait between delivery attempts.
+func fastBackoff() commo.BackoffConfig {
+	return commo.BackoffConfig{
+		Timeout:         1 * time.Second,
+		InitialInterval: 1 * time.Millisecond,
+		MaxInterval:     1 * time.Millisecond,
+		MaxElapsedTime:  1 * time.Second,
+	}
+}
+
+// A backend that calls the function to send messages.
+type backendFunc func(context.Context, *commo.Message) error
+
+func (f backendFunc) Send(ctx context.Context, msg *commo.Message) error { return f(ctx, msg) }
+func (f backendFunc) Name() string                                       { return "func" }
+func (f backendFunc) Close() error                                       { return nil }
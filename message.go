@@ -0,0 +1,338 @@
+package commo
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jordan-wright/email"
+
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Message is an email that has been validated and rendered by Prepare and is ready to
+// be delivered. The templates are not rendered again when a message is sent, so a
+// message can be inspected, stored (it marshals to JSON), and sent later or retried
+// without changing. Messages are immutable: the accessors return copies of the data.
+type Message struct {
+	sender      string
+	to          []string
+	cc          []string
+	bcc         []string
+	replyTo     string
+	subject     string
+	headers     map[string]string
+	text        []byte
+	html        []byte
+	attachments []*Attachment
+	tags        []string
+	template    string
+	locale      string
+}
+
+// Prepare validates the email and renders it with the templates of its mailer into a
+// message that can be delivered by any backend. Attachments are read and their content
+// types detected so that the message does not depend on the readers of the email. The
+// email is not modified, so it can be prepared and sent from multiple goroutines.
+func (e *Email) Prepare() (*Message, error) {
+	return e.getMailer().prepare(e)
+}
+
+// Validate the email and render it with the templates and inline images of the mailer,
+// which is the mailer that sends the email rather than the mailer that created it.
+func (m *Mailer) prepare(e *Email) (msg *Message, err error) {
+	if err = e.Validate(); err != nil {
+		return nil, err
+	}
+
+	msg = &Message{
+		sender:   e.Sender,
+		to:       slices.Clone(e.To),
+		cc:       slices.Clone(e.CC),
+		bcc:      slices.Clone(e.BCC),
+		replyTo:  e.ReplyTo,
+		subject:  e.Subject,
+		tags:     slices.Clone(e.Tags),
+		template: e.Template,
+		locale:   e.Locale,
+	}
+
+	if msg.headers, err = e.headers(); err != nil {
+		return nil, err
+	}
+
+	if msg.text, msg.html, err = m.render(e.Template, e.Locale, e.Data); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range e.withInline(m, msg.html) {
+		var data []byte
+		if data, err = attachment.Content(); err != nil {
+			return nil, err
+		}
+
+		msg.attachments = append(msg.attachments, &Attachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.detectType(data),
+			Data:        bytes.Clone(data),
+			Inline:      attachment.Inline,
+		})
+	}
+
+	return msg, nil
+}
+
+func (m *Message) Sender() string   { return m.sender }
+func (m *Message) To() []string     { return slices.Clone(m.to) }
+func (m *Message) CC() []string     { return slices.Clone(m.cc) }
+func (m *Message) BCC() []string    { return slices.Clone(m.bcc) }
+func (m *Message) ReplyTo() string  { return m.replyTo }
+func (m *Message) Subject() string  { return m.subject }
+func (m *Message) Text() []byte     { return bytes.Clone(m.text) }
+func (m *Message) HTML() []byte     { return bytes.Clone(m.html) }
+func (m *Message) Tags() []string   { return slices.Clone(m.tags) }
+func (m *Message) Template() string { return m.template }
+func (m *Message) Locale() string   { return m.locale }
+
+// MessageID returns the Message-ID header of the message, including angle brackets.
+func (m *Message) MessageID() string {
+	return m.headers["Message-ID"]
+}
+
+// Headers returns the custom and threading headers of the message.
+func (m *Message) Headers() map[string]string {
+	return maps.Clone(m.headers)
+}
+
+// Attachments returns the attachments of the message, including the inline images
+// that are referenced by the html.
+func (m *Message) Attachments() []*Attachment {
+	out := make([]*Attachment, 0, len(m.attachments))
+	for _, attachment := range m.attachments {
+		out = append(out, &Attachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Data:        bytes.Clone(attachment.Data),
+			Inline:      attachment.Inline,
+		})
+	}
+	return out
+}
+
+// ToSMTP returns an email struct that can be sent via SMTP.
+func (m *Message) ToSMTP() (msg *email.Email, err error) {
+	msg = email.NewEmail()
+	msg.From = m.sender
+	msg.To = m.To()
+	msg.Cc = m.CC()
+	msg.Bcc = m.BCC()
+	msg.Subject = m.subject
+	msg.Text = m.Text()
+	msg.HTML = m.HTML()
+
+	if m.replyTo != "" {
+		msg.ReplyTo = []string{m.replyTo}
+	}
+
+	for key, value := range m.headers {
+		msg.Headers.Set(key, value)
+	}
+
+	if err = attachSMTP(msg, m.attachments); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// ToSendGrid returns an email struct that can be sent via SendGrid.
+func (m *Message) ToSendGrid() (msg *sgmail.SGMailV3, err error) {
+	// See: https://github.com/sendgrid/sendgrid-go/blob/16f25e4d92886b2733473a19977ccf1aa625a89b/helpers/mail/mail_v3.go#L186-L195
+	msg = new(sgmail.SGMailV3)
+	msg.Subject = m.subject
+
+	var from *sgmail.Email
+	if from, err = NewSGEmail(m.sender); err != nil {
+		return nil, err
+	}
+	msg.SetFrom(from)
+
+	// SendGrid rejects a personalization with an address in more than one of the to,
+	// cc, and bcc lists, so only the first occurrence of each address is kept.
+	p := sgmail.NewPersonalization()
+	seen := make(map[string]struct{}, len(m.to)+len(m.cc)+len(m.bcc))
+	for _, recipients := range []struct {
+		addrs []string
+		add   func(...*sgmail.Email)
+	}{{m.to, p.AddTos}, {m.cc, p.AddCCs}, {m.bcc, p.AddBCCs}} {
+		var addrs []*sgmail.Email
+		if addrs, err = NewSGEmails(recipients.addrs); err != nil {
+			return nil, err
+		}
+
+		unique := addrs[:0]
+		for _, addr := range addrs {
+			key := strings.ToLower(addr.Address)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			unique = append(unique, addr)
+		}
+
+		if len(unique) > 0 {
+			recipients.add(unique...)
+		}
+	}
+	msg.AddPersonalizations(p)
+
+	if m.replyTo != "" {
+		var replyTo *sgmail.Email
+		if replyTo, err = NewSGEmail(m.replyTo); err != nil {
+			return nil, err
+		}
+		msg.SetReplyTo(replyTo)
+	}
+
+	msg.Headers = m.Headers()
+	if len(m.tags) > 0 {
+		msg.AddCategories(m.Tags()...)
+	}
+
+	msg.AddContent(
+		sgmail.NewContent("text/plain", string(m.text)),
+		sgmail.NewContent("text/html", string(m.html)),
+	)
+
+	if err = attachSendGrid(msg, m.attachments); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// The JSON representation of a message so that it can be stored and sent later.
+type messageJSON struct {
+	Sender      string            `json:"sender"`
+	To          []string          `json:"to"`
+	CC          []string          `json:"cc,omitempty"`
+	BCC         []string          `json:"bcc,omitempty"`
+	ReplyTo     string            `json:"reply_to,omitempty"`
+	Subject     string            `json:"subject"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Text        string            `json:"text"`
+	HTML        string            `json:"html"`
+	Attachments []attachmentJSON  `json:"attachments,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Template    string            `json:"template,omitempty"`
+	Locale      string            `json:"locale,omitempty"`
+}
+
+type attachmentJSON struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+	Inline      bool   `json:"inline,omitempty"`
+}
+
+func (m *Message) MarshalJSON() ([]byte, error) {
+	data := messageJSON{
+		Sender:   m.sender,
+		To:       m.to,
+		CC:       m.cc,
+		BCC:      m.bcc,
+		ReplyTo:  m.replyTo,
+		Subject:  m.subject,
+		Headers:  m.headers,
+		Text:     string(m.text),
+		HTML:     string(m.html),
+		Tags:     m.tags,
+		Template: m.template,
+		Locale:   m.locale,
+	}
+
+	for _, attachment := range m.attachments {
+		data.Attachments = append(data.Attachments, attachmentJSON{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Data:        attachment.Data,
+			Inline:      attachment.Inline,
+		})
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON decodes a stored message and validates its addresses, headers, and
+// attachments; an error is returned if the message could not have been prepared.
+func (m *Message) UnmarshalJSON(b []byte) (err error) {
+	var data messageJSON
+	if err = json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+
+	*m = Message{
+		sender:   data.Sender,
+		to:       data.To,
+		cc:       data.CC,
+		bcc:      data.BCC,
+		replyTo:  data.ReplyTo,
+		subject:  data.Subject,
+		headers:  data.Headers,
+		text:     []byte(data.Text),
+		html:     []byte(data.HTML),
+		tags:     data.Tags,
+		template: data.Template,
+		locale:   data.Locale,
+	}
+
+	for _, attachment := range data.Attachments {
+		m.attachments = append(m.attachments, &Attachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Data:        attachment.Data,
+			Inline:      attachment.Inline,
+		})
+	}
+
+	if err = m.validate(); err != nil {
+		*m = Message{}
+		return err
+	}
+	return nil
+}
+
+// Validate a message that was decoded from JSON rather than prepared from an email, so
+// that a stored message that was modified or corrupted cannot be sent.
+func (m *Message) validate() (err error) {
+	switch {
+	case m.subject == "":
+		return ErrMissingSubject
+	case m.sender == "":
+		return ErrMissingSender
+	case len(m.to) == 0:
+		return ErrMissingRecipient
+	}
+
+	if err = validateAddresses(m.sender, m.replyTo, m.to, m.cc, m.bcc); err != nil {
+		return err
+	}
+
+	if err = m.validateHeaders(); err != nil {
+		return err
+	}
+
+	for _, attachment := range m.attachments {
+		if err = attachment.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// The backends check their own limits when the message is sent; this is the
+	// largest size that any backend accepts.
+	if _, err = readAttachments(m.attachments, MaxSendGridAttachmentSize); err != nil {
+		return err
+	}
+	return nil
+}
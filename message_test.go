@@ -0,0 +1,205 @@
+package commo_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+// Counts how many times the templates read the contact name of the data.
+type countingData struct {
+	calls *int
+}
+
+func (d countingData) ContactName() string {
+	*d.calls++
+	return "Tess Tester"
+}
+
+func TestPrepare(t *testing.T) {
+	mailer, err := commo.NewMailer(commo.Config{Sender: "Jane Szack <jane@example.com>", Testing: true}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	email, err := mailer.New("Tess Tester <tess@example.com>", "Welcome", "test_email", struct{ ContactName string }{"Tess Tester"})
+	require.NoError(t, err, "could not create email")
+	email.CC = []string{"ralph@example.com"}
+	email.Tags = []string{"welcome"}
+	email.Attach("notes.txt", "", []byte("some notes"))
+
+	msg, err := email.Prepare()
+	require.NoError(t, err, "could not prepare email")
+	require.Equal(t, "Jane Szack <jane@example.com>", msg.Sender())
+	require.Equal(t, []string{"Tess Tester <tess@example.com>"}, msg.To())
+	require.Equal(t, []string{"ralph@example.com"}, msg.CC())
+	require.Equal(t, "Welcome", msg.Subject())
+	require.Equal(t, "test_email", msg.Template())
+	require.Contains(t, string(msg.Text()), "Hello Tess Tester,")
+	require.Contains(t, string(msg.HTML()), "Hello Tess Tester,")
+	require.NotEmpty(t, msg.MessageID(), "expected a message id to be generated")
+	require.Empty(t, email.MessageID, "expected the email not to be modified")
+
+	attachments := msg.Attachments()
+	require.Len(t, attachments, 1)
+	require.Equal(t, "notes.txt", attachments[0].Filename)
+	require.Equal(t, "text/plain; charset=utf-8", attachments[0].ContentType)
+
+	// The message is not changed by the email or by the values returned by accessors.
+	email.To[0] = "ralph@example.com"
+	email.Attachments[0].Data[0] = 'S'
+	msg.To()[0] = "nobody@example.com"
+	msg.Text()[0] = 'J'
+	attachments[0].Data[0] = 'X'
+
+	require.Equal(t, []string{"Tess Tester <tess@example.com>"}, msg.To())
+	require.Contains(t, string(msg.Text()), "Hello Tess Tester,")
+	require.Equal(t, []byte("some notes"), msg.Attachments()[0].Data)
+
+	t.Run("Invalid", func(t *testing.T) {
+		email, err := mailer.New("tess@example.com", "", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		_, err = email.Prepare()
+		require.ErrorIs(t, err, commo.ErrMissingSubject)
+
+		email, err = mailer.New("tess@example.com", "Unknown", "unknown", nil)
+		require.NoError(t, err, "could not create email")
+
+		_, err = email.Prepare()
+		require.Error(t, err, "expected a rendering error")
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		data, err := json.Marshal(msg)
+		require.NoError(t, err, "could not marshal message")
+
+		restored := &commo.Message{}
+		require.NoError(t, json.Unmarshal(data, restored), "could not unmarshal message")
+		require.Equal(t, msg, restored)
+
+		// The restored message can be sent later by the mailer.
+		require.NoError(t, mailer.SendMessage(context.Background(), restored), "could not send message")
+		outbox := mailer.Mock().Outbox()
+		require.Len(t, outbox, 1)
+		require.Equal(t, "Welcome", outbox[0].Subject)
+		require.Equal(t, msg.MessageID(), outbox[0].Headers.Get("Message-ID"))
+		require.Len(t, outbox[0].Attachments, 1)
+	})
+
+	t.Run("InvalidJSON", func(t *testing.T) {
+		data, err := json.Marshal(msg)
+		require.NoError(t, err, "could not marshal message")
+
+		testCases := []struct {
+			name   string
+			modify func(map[string]any)
+			err    error
+		}{
+			{"NoRecipients", func(m map[string]any) { delete(m, "to") }, commo.ErrMissingRecipient},
+			{"NoSender", func(m map[string]any) { m["sender"] = "" }, commo.ErrMissingSender},
+			{"BadRecipient", func(m map[string]any) { m["cc"] = []string{"not an email"} }, commo.ErrIncorrectEmail},
+			{"ReservedHeader", func(m map[string]any) { m["headers"].(map[string]any)["Bcc"] = "eve@example.com" }, commo.ErrReservedHeader},
+			{"InvalidHeader", func(m map[string]any) { m["headers"].(map[string]any)["X-Test"] = "a\r\nBcc: eve@example.com" }, commo.ErrInvalidHeader},
+			{"InvalidMessageID", func(m map[string]any) { m["headers"].(map[string]any)["Message-ID"] = "<nodomain>" }, commo.ErrInvalidMessageID},
+			{"AttachmentName", func(m map[string]any) { m["attachments"].([]any)[0].(map[string]any)["filename"] = "" }, commo.ErrMissingAttachmentName},
+			{"AttachmentData", func(m map[string]any) { m["attachments"].([]any)[0].(map[string]any)["data"] = nil }, commo.ErrMissingAttachmentData},
+			{"AttachmentSize", func(m map[string]any) {
+				m["attachments"].([]any)[0].(map[string]any)["data"] = make([]byte, commo.MaxSendGridAttachmentSize)
+			}, commo.ErrAttachmentTooLarge},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				payload := make(map[string]any)
+				require.NoError(t, json.Unmarshal(data, &payload), "could not decode message")
+				tc.modify(payload)
+
+				invalid, err := json.Marshal(payload)
+				require.NoError(t, err, "could not encode message")
+
+				restored := &commo.Message{}
+				require.ErrorIs(t, json.Unmarshal(invalid, restored), tc.err)
+				require.Equal(t, &commo.Message{}, restored, "expected the invalid message to be discarded")
+			})
+		}
+	})
+}
+
+func TestSendRendersOnce(t *testing.T) {
+	conf := commo.Config{
+		Sender:  "test@example.com",
+		Backoff: fastBackoff(),
+	}
+
+	mock, err := commo.NewMailer(commo.Config{Sender: "test@example.com", Testing: true}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	calls := 0
+	email, err := mock.New("test@example.com", "Test Subject", "test_email", countingData{&calls})
+	require.NoError(t, err, "could not create email")
+
+	prepared, err := email.Prepare()
+	require.NoError(t, err, "could not prepare email")
+	rendered := calls
+	require.NotZero(t, rendered, "expected the templates to read the data")
+
+	// Every attempt delivers the same prepared message.
+	attempts := 0
+	backend := backendFunc(func(context.Context, *commo.Message) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	m, err := commo.NewMailerWithBackend(conf, backend, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	calls = 0
+	sent, err := m.New("test@example.com", "Test Subject", "test_email", countingData{&calls})
+	require.NoError(t, err, "could not create email")
+	require.NoError(t, sent.Send(), "could not send email")
+	require.Equal(t, 3, attempts)
+	require.Equal(t, rendered, calls, "expected the email to be rendered once")
+
+	// Rendering errors are not delivered or retried.
+	attempts = 0
+	sent, err = m.New("test@example.com", "Test Subject", "unknown", nil)
+	require.NoError(t, err, "could not create email")
+	require.Error(t, sent.Send(), "expected a rendering error")
+	require.Zero(t, attempts, "expected no delivery attempts")
+
+	// Prepared messages can be sent by any backend.
+	attempts = 2
+	require.NoError(t, m.SendMessage(context.Background(), prepared), "could not send message")
+	require.Equal(t, 3, attempts)
+}
+
+func TestSendConcurrent(t *testing.T) {
+	mailer, err := commo.NewMailer(commo.Config{Sender: "test@example.com", Testing: true}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	email, err := mailer.New("test@example.com", "Test Subject", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+
+	// The same email can be sent from multiple goroutines since it is not modified.
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, email.Send(), "could not send email")
+		}()
+	}
+	wg.Wait()
+
+	outbox := mailer.Mock().Outbox()
+	require.Len(t, outbox, 8)
+	require.Empty(t, email.MessageID, "expected the email not to be modified")
+	require.NotEqual(t, outbox[0].Headers.Get("Message-ID"), outbox[1].Headers.Get("Message-ID"), "expected every send to have its own message id")
+}
@@ -0,0 +1,108 @@
+package commo
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"strings"
+)
+
+// Names of the template blocks that declare the metadata of an email template, e.g.
+//
+//	{{ define "subject" }}Your invoice #{{ .Number }}{{ end }}
+//	{{ define "sender" }}Billing <billing@example.com>{{ end }}
+//	{{ define "tags" }}billing, invoice{{ end }}
+//
+// The blocks are looked up in the text template first and then the html template.
+const (
+	SubjectBlock   = "subject"
+	PreheaderBlock = "preheader"
+	SenderBlock    = "sender"
+	TagsBlock      = "tags"
+)
+
+// Metadata is rendered from the metadata blocks of an email template with the same
+// data as the body of the email. Fields are empty if the template does not declare
+// the corresponding block.
+type Metadata struct {
+	Subject   string
+	Preheader string
+	Sender    string
+	Tags      []string
+}
+
+// RenderMetadata renders the metadata blocks of the email template with the specified
+// name and data using the default mailer.
+func RenderMetadata(name string, data any) (*Metadata, error) {
+	return defaultMailer().RenderMetadata(name, data)
+}
+
+// RenderMetadata renders the metadata blocks of the email template of the mailer with
+// the specified name and data. Whitespace in the rendered blocks is collapsed and tags
+// are separated by commas. Localized mailers render the blocks of the localized
+// variant of the template.
+func (m *Mailer) RenderMetadata(name string, data any) (meta *Metadata, err error) {
+	return m.renderMetadata(name, m.locale, data)
+}
+
+func (m *Mailer) renderMetadata(name, locale string, data any) (meta *Metadata, err error) {
+	if m.templs == nil {
+		return nil, ErrTemplatesNotLoaded
+	}
+
+	set, name := m.templs.resolve(name, locale)
+	if _, ok := set.HTML[name]; !ok {
+		return nil, templateNotFound(name + HTMLExt)
+	}
+
+	// Blocks are rendered in order so that the same error is returned for a template.
+	meta = &Metadata{}
+	for _, block := range []struct {
+		name  string
+		field *string
+	}{
+		{SubjectBlock, &meta.Subject},
+		{PreheaderBlock, &meta.Preheader},
+		{SenderBlock, &meta.Sender},
+	} {
+		if *block.field, err = renderBlock(set, name, block.name, data); err != nil {
+			return nil, err
+		}
+	}
+
+	var tags string
+	if tags, err = renderBlock(set, name, TagsBlock, data); err != nil {
+		return nil, err
+	}
+
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			meta.Tags = append(meta.Tags, tag)
+		}
+	}
+	return meta, nil
+}
+
+// Render a block of the text or html template onto a single line; the html template
+// is unescaped since metadata is used in headers rather than in the html body.
+func renderBlock(set *Templates, name, block string, data any) (_ string, err error) {
+	buf := &bytes.Buffer{}
+	if tt, ok := set.Text[name]; ok && tt.Lookup(block) != nil {
+		if err = tt.ExecuteTemplate(buf, block, data); err != nil {
+			return "", newTemplateError(name, err, data, func(data any) error {
+				return tt.ExecuteTemplate(io.Discard, block, data)
+			})
+		}
+		return strings.Join(strings.Fields(buf.String()), " "), nil
+	}
+
+	if ht := set.HTML[name]; ht.Lookup(block) != nil {
+		if err = ht.ExecuteTemplate(buf, block, data); err != nil {
+			return "", newTemplateError(name, err, data, func(data any) error {
+				return ht.ExecuteTemplate(io.Discard, block, data)
+			})
+		}
+		return strings.Join(strings.Fields(html.UnescapeString(buf.String())), " "), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,105 @@
+package commo_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+type invoiceData struct {
+	ContactName string
+	Company     string
+	Number      int
+	Amount      string
+}
+
+func TestRenderMetadata(t *testing.T) {
+	mailer, err := commo.NewMailer(commo.Config{Sender: "jane@example.com"}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	data := invoiceData{ContactName: "Tess", Company: "Bits & Bobs", Number: 1234, Amount: "$42.00"}
+	meta, err := mailer.RenderMetadata("invoice", data)
+	require.NoError(t, err, "could not render invoice metadata")
+	require.Equal(t, &commo.Metadata{
+		Subject:   "Your invoice #1234 from Bits & Bobs",
+		Preheader: "Your invoice for $42.00 is ready.",
+		Sender:    "Billing <billing@example.com>",
+		Tags:      []string{"billing", "invoice"},
+	}, meta)
+
+	// Templates without metadata blocks only have the preheader of the base template.
+	meta, err = mailer.RenderMetadata("test_email", nil)
+	require.NoError(t, err, "could not render test_email metadata")
+	require.Equal(t, &commo.Metadata{Preheader: "Here is a test email."}, meta)
+
+	_, err = mailer.RenderMetadata("foo", nil)
+	require.EqualError(t, err, `could not find "foo.html" in templates: template does not exist`)
+
+	t.Run("HTMLBlocks", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"welcome.html": {Data: []byte(`{{ define "subject" }}Welcome,
+				{{ .Name }}!{{ end }}<p>Welcome</p>`)},
+		}
+
+		templates, err := commo.LoadTemplates(fsys, commo.Layout{GenerateText: true})
+		require.NoError(t, err, "could not load templates")
+
+		mailer, err := commo.NewMailer(commo.Config{}, templates)
+		require.NoError(t, err, "could not create mailer")
+
+		meta, err := mailer.RenderMetadata("welcome", map[string]string{"Name": "Tess O'Brien <Sons>"})
+		require.NoError(t, err, "could not render metadata")
+		require.Equal(t, "Welcome, Tess O'Brien <Sons>!", meta.Subject, "expected subject to be unescaped and on one line")
+	})
+}
+
+func TestTemplatedSubject(t *testing.T) {
+	mailer, err := commo.NewMailer(commo.Config{Sender: "jane@example.com"}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	data := invoiceData{ContactName: "Tess", Company: "Bits & Bobs", Number: 1234, Amount: "$42.00"}
+	email, err := mailer.New("tess@example.com", "", "invoice", data)
+	require.NoError(t, err, "could not create email")
+	require.Equal(t, "Your invoice #1234 from Bits & Bobs", email.Subject)
+	require.Equal(t, "jane@example.com", email.Sender, "the configured sender is not overridden by the template")
+	require.Equal(t, []string{"billing", "invoice"}, email.Tags)
+
+	msg, err := email.ToSendGrid()
+	require.NoError(t, err, "could not create sendgrid email")
+	require.Equal(t, "Your invoice #1234 from Bits & Bobs", msg.Subject)
+	require.Equal(t, []string{"billing", "invoice"}, msg.Categories)
+
+	// An explicit subject is not overridden by the template.
+	email, err = mailer.New("tess@example.com", "Overdue invoice", "invoice", data)
+	require.NoError(t, err, "could not create email")
+	require.Equal(t, "Overdue invoice", email.Subject)
+
+	// Templates without a subject block still require a subject.
+	email, err = mailer.New("tess@example.com", "", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+	require.Equal(t, "jane@example.com", email.Sender)
+	require.ErrorIs(t, email.Validate(), commo.ErrMissingSubject)
+
+	// Errors rendering the metadata are returned by New.
+	_, err = mailer.New("tess@example.com", "", "invoice", map[string]any{"Number": []int{}})
+	require.NoError(t, err, "missing map keys are not an error")
+
+	// The subject and preheader both fail; the subject is always rendered first.
+	for range 10 {
+		_, err = mailer.New("tess@example.com", "", "invoice", struct{}{})
+		require.ErrorContains(t, err, `could not render metadata for "invoice"`)
+		require.ErrorContains(t, err, `executing "subject"`)
+	}
+
+	// The template sender is used if no sender is configured or if it is enabled.
+	for _, conf := range []commo.Config{{}, {Sender: "jane@example.com", TemplateSender: true}} {
+		mailer, err := commo.NewMailer(conf, loadTestTemplates())
+		require.NoError(t, err, "could not create mailer")
+
+		email, err := mailer.New("tess@example.com", "", "invoice", data)
+		require.NoError(t, err, "could not create email")
+		require.Equal(t, "Billing <billing@example.com>", email.Sender)
+	}
+}
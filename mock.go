@@ -0,0 +1,139 @@
+package commo
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jordan-wright/email"
+)
+
+// MockBackend captures rendered emails in an in-memory outbox rather than delivering
+// them. It is used when the configuration is in testing mode and provides helpers to
+// make assertions about the emails that were sent in unit tests.
+type MockBackend struct {
+	mu     sync.Mutex
+	outbox []*email.Email
+	sent   chan struct{}
+}
+
+var _ Backend = &MockBackend{}
+
+// NewMockBackend creates a mock backend with an empty outbox.
+func NewMockBackend() *MockBackend {
+	return &MockBackend{sent: make(chan struct{})}
+}
+
+// Send stores the message in the outbox as it would be sent via SMTP. Because the mock
+// never fails to deliver, any error is a conversion error and is returned as a permanent
+// error so that it is not retried; the mock delivers immediately so the context is not
+// used.
+func (b *MockBackend) Send(_ context.Context, m *Message) (err error) {
+	var msg *email.Email
+	if msg, err = m.ToSMTP(); err != nil {
+		return Permanent(err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.outbox = append(b.outbox, msg)
+
+	// Wake up any routines that are waiting for emails to be sent.
+	close(b.sent)
+	b.sent = make(chan struct{})
+	return nil
+}
+
+func (b *MockBackend) Name() string {
+	return "mock"
+}
+
+// Close is a no-op so that the outbox can still be inspected after the mailer is closed.
+func (b *MockBackend) Close() error {
+	return nil
+}
+
+// Outbox returns a copy of all of the emails that have been sent in the order that
+// they were sent in.
+func (b *MockBackend) Outbox() []*email.Email {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make([]*email.Email, len(b.outbox))
+	copy(out, b.outbox)
+	return out
+}
+
+// Reset removes all emails from the outbox.
+func (b *MockBackend) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.outbox = nil
+}
+
+// WaitFor blocks until at least n emails are in the outbox or until the timeout is
+// reached, which is useful when emails are sent from a background routine.
+func (b *MockBackend) WaitFor(n int, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		b.mu.Lock()
+		count, sent := len(b.outbox), b.sent
+		b.mu.Unlock()
+
+		if count >= n {
+			return nil
+		}
+
+		select {
+		case <-sent:
+		case <-deadline.C:
+			return ErrMockTimeout
+		}
+	}
+}
+
+// FindByRecipient returns all emails in the outbox where the address is one of the
+// To, Cc, or Bcc recipients. Only the email address is compared, not the name.
+func (b *MockBackend) FindByRecipient(address string) []*email.Email {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+
+	return b.find(func(msg *email.Email) bool {
+		for _, list := range [][]string{msg.To, msg.Cc, msg.Bcc} {
+			for _, recipient := range list {
+				if parsed, err := mail.ParseAddress(recipient); err == nil {
+					recipient = parsed.Address
+				}
+
+				if strings.EqualFold(recipient, address) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// FindBySubject returns all emails in the outbox with exactly the specified subject.
+func (b *MockBackend) FindBySubject(subject string) []*email.Email {
+	return b.find(func(msg *email.Email) bool {
+		return msg.Subject == subject
+	})
+}
+
+func (b *MockBackend) find(match func(*email.Email) bool) (out []*email.Email) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, msg := range b.outbox {
+		if match(msg) {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
@@ -0,0 +1,74 @@
+package commo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+func TestMock(t *testing.T) {
+	conf := commo.Config{
+		Sender:  "Peony Quarterdeck <peony@example.com>",
+		Testing: true,
+	}
+
+	err := commo.Initialize(conf, loadTestTemplates())
+	require.NoError(t, err, "could not initialize in testing mode")
+	t.Cleanup(func() { commo.Close() })
+
+	mock := commo.Mock()
+	require.NotNil(t, mock, "expected a mock backend in testing mode")
+	require.Equal(t, "mock", mock.Name())
+	require.Empty(t, mock.Outbox())
+
+	data := struct{ ContactName string }{ContactName: "Tess Tester"}
+	email, err := commo.New("Tess Tester <tess@example.com>", "Welcome", "test_email", data)
+	require.NoError(t, err, "could not create email")
+	require.NoError(t, email.Send(), "could not send email")
+
+	email, err = commo.New("ralph@example.com", "Reminder", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+	require.NoError(t, email.Send(), "could not send email")
+
+	outbox := mock.Outbox()
+	require.Len(t, outbox, 2)
+	require.Equal(t, conf.Sender, outbox[0].From)
+	require.Equal(t, []string{"Tess Tester <tess@example.com>"}, outbox[0].To)
+	require.Contains(t, string(outbox[0].Text), "Hello Tess Tester,")
+	require.Contains(t, string(outbox[0].HTML), "Hello Tess Tester,")
+
+	found := mock.FindByRecipient("TESS@example.com")
+	require.Len(t, found, 1)
+	require.Equal(t, "Welcome", found[0].Subject)
+
+	found = mock.FindBySubject("Reminder")
+	require.Len(t, found, 1)
+	require.Equal(t, []string{"ralph@example.com"}, found[0].To)
+
+	require.Empty(t, mock.FindByRecipient("nobody@example.com"))
+	require.Empty(t, mock.FindBySubject("Goodbye"))
+
+	t.Run("WaitFor", func(t *testing.T) {
+		mock.Reset()
+		require.Empty(t, mock.Outbox())
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			email, _ := commo.New("tess@example.com", "Delayed", "test_email", nil)
+			email.Send()
+		}()
+
+		require.NoError(t, mock.WaitFor(1, 5*time.Second))
+		require.ErrorIs(t, mock.WaitFor(2, 10*time.Millisecond), commo.ErrMockTimeout)
+	})
+
+	t.Run("RenderError", func(t *testing.T) {
+		mock.Reset()
+		email, err := commo.New("tess@example.com", "Unknown", "foo", nil)
+		require.NoError(t, err, "could not create email")
+		require.EqualError(t, email.Send(), "could not find \"foo.txt\" in templates: template does not exist")
+		require.Empty(t, mock.Outbox())
+	})
+}
@@ -0,0 +1,84 @@
+package preview
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFixture is the name of the fixture that is rendered when no fixture is
+// selected; if a template has no default fixture its first fixture is rendered.
+const DefaultFixture = "default"
+
+var ErrUnknownFormat = errors.New("fixtures must be a .json, .yaml, or .yml file")
+
+// Fixtures are named sample data for each email template, keyed by the name of the
+// template and then by the name of the fixture, e.g.
+//
+//	welcome:
+//	  default:
+//	    ContactName: Tess Tester
+//	  long-name:
+//	    ContactName: Maximiliana Wolfeschlegelsteinhausenbergerdorff
+type Fixtures map[string]map[string]any
+
+// LoadFixtures reads the fixtures from a JSON or YAML file in the file system; the
+// format is determined by the extension of the file.
+func LoadFixtures(fsys fs.FS, name string) (fixtures Fixtures, err error) {
+	var data []byte
+	if data, err = fs.ReadFile(fsys, name); err != nil {
+		return nil, fmt.Errorf("could not read fixtures: %w", err)
+	}
+
+	switch path.Ext(name) {
+	case ".json":
+		err = json.Unmarshal(data, &fixtures)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &fixtures)
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not parse fixtures %q: %w", name, err)
+	}
+	return fixtures, nil
+}
+
+// Names returns the sorted names of the fixtures of the template with the default
+// fixture first.
+func (f Fixtures) Names(template string) []string {
+	names := make([]string, 0, len(f[template]))
+	for name := range f[template] {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == DefaultFixture || names[j] == DefaultFixture {
+			return names[i] == DefaultFixture
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// Lookup returns the fixture of the template with the specified name; if the name is
+// empty the default (or first) fixture is returned. The data is nil if the template
+// has no fixtures so that templates without fixtures can still be previewed.
+func (f Fixtures) Lookup(template, name string) (_ string, data any, ok bool) {
+	if name == "" {
+		names := f.Names(template)
+		if len(names) == 0 {
+			return "", nil, true
+		}
+		name = names[0]
+	}
+
+	data, ok = f[template][name]
+	return name, data, ok
+}
@@ -0,0 +1,96 @@
+package preview
+
+import "html/template"
+
+var (
+	indexTemplate   = parsePage("index", indexPageHTML)
+	previewTemplate = parsePage("preview", previewPageHTML)
+)
+
+// The layout is parsed before the page so that the page can override its blocks.
+func parsePage(name, page string) *template.Template {
+	return template.Must(template.Must(template.New(name).Parse(layout)).Parse(page))
+}
+
+const layout = `{{ define "head" }}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ block "title" . }}Email Previews{{ end }}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 0; color: #222; background: #f4f4f5; }
+header { padding: 12px 24px; background: #fff; border-bottom: 1px solid #ddd; }
+header a { color: inherit; text-decoration: none; font-weight: 600; }
+main { padding: 24px; }
+form { display: flex; gap: 16px; align-items: center; flex-wrap: wrap; margin-bottom: 16px; }
+table { border-collapse: collapse; background: #fff; }
+th, td { text-align: left; padding: 8px 12px; border-bottom: 1px solid #eee; vertical-align: top; }
+.error { padding: 12px; margin-bottom: 16px; background: #fdecea; color: #8a1c14; white-space: pre-wrap; font-family: monospace; }
+.panes { display: flex; gap: 24px; flex-wrap: wrap; align-items: flex-start; }
+iframe { background: #fff; border: 1px solid #ddd; width: 100%; height: 80vh; }
+iframe.mobile { width: 375px; }
+.html { flex: 2 1 600px; }
+.text { flex: 1 1 320px; }
+pre { background: #fff; border: 1px solid #ddd; padding: 12px; white-space: pre-wrap; margin: 0; }
+</style>
+</head>
+<body>
+<header><a href="{{ block "home" . }}./{{ end }}">Email Previews</a></header>
+<main>
+{{ with .Error }}<div class="error">{{ . }}</div>{{ end }}
+{{ end }}
+
+{{ define "foot" }}</main>
+</body>
+</html>{{ end }}`
+
+const indexPageHTML = `{{ template "head" . }}
+{{ with .Locales }}<p>Locales: {{ range $i, $locale := . }}{{ if $i }}, {{ end }}{{ $locale }}{{ end }}</p>{{ end }}
+<table>
+  <tr><th>Template</th><th>Fixtures</th></tr>
+  {{ range .Templates }}
+  <tr>
+    <td><a href="templates/{{ .Name }}">{{ .Name }}</a></td>
+    <td>{{ $name := .Name }}{{ range .Fixtures }}<a href="templates/{{ $name }}?fixture={{ . }}">{{ . }}</a> {{ else }}<em>none</em>{{ end }}</td>
+  </tr>
+  {{ else }}
+  <tr><td colspan="2"><em>no templates have been loaded</em></td></tr>
+  {{ end }}
+</table>
+{{ template "foot" . }}`
+
+const previewPageHTML = `{{ define "title" }}{{ .Name }} &middot; Email Previews{{ end }}
+{{ define "home" }}../{{ end }}
+{{ template "head" . }}
+<h1>{{ .Name }}</h1>
+<form method="get" action="{{ .Name }}">
+  {{ if .Fixtures }}
+  <label>Fixture
+    <select name="fixture" onchange="this.form.submit()">
+      {{ $fixture := .Fixture }}{{ range .Fixtures }}<option{{ if eq . $fixture }} selected{{ end }}>{{ . }}</option>{{ end }}
+    </select>
+  </label>
+  {{ end }}
+  <label>Locale
+    <select name="locale" onchange="this.form.submit()">
+      <option value="">default</option>
+      {{ $locale := .Locale }}{{ range .Locales }}<option{{ if eq . $locale }} selected{{ end }}>{{ . }}</option>{{ end }}
+    </select>
+  </label>
+  <label><input type="checkbox" name="mobile" value="true"{{ if .Mobile }} checked{{ end }} onchange="this.form.submit()"> Mobile width</label>
+  <a href="{{ .Name }}/source?{{ .Query }}">MIME source</a>
+</form>
+{{ if not .Error }}
+<table>
+  <tr><th>Subject</th><td>{{ .Subject }}</td></tr>
+  <tr><th>From</th><td>{{ .Sender }}</td></tr>
+  <tr><th>To</th><td>{{ .To }}</td></tr>
+</table>
+<br>
+<div class="panes">
+  <div class="html"><iframe title="html" src="{{ .Name }}/html?{{ .Query }}"{{ if .Mobile }} class="mobile"{{ end }}></iframe></div>
+  <div class="text"><pre>{{ .Text }}</pre></div>
+</div>
+{{ end }}
+{{ template "foot" . }}`
@@ -0,0 +1,199 @@
+/*
+Package preview provides an HTTP handler that renders the email templates of a mailer
+with sample data so that designers can review emails locally without sending them.
+The handler lists every loaded template and renders its html, text, and subject with
+named fixtures, in any of the supported locales, and serves the raw MIME source of the
+message as it would be sent over SMTP.
+
+Usage Example:
+
+	templates, err := commo.WatchTemplates(os.DirFS("templates"), commo.DefaultLayout, time.Second)
+	checkErr(err)
+
+	mailer, err := commo.NewMailer(commo.Config{}, templates)
+	checkErr(err)
+
+	fixtures, err := preview.LoadFixtures(os.DirFS("templates"), "fixtures.yaml")
+	checkErr(err)
+
+	http.Handle("/preview/", http.StripPrefix("/preview", preview.New(mailer, fixtures)))
+*/
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"go.rtnl.ai/commo"
+)
+
+// Addresses that are used to build the preview messages if the mailer does not have a
+// configured sender or the template does not declare one.
+const (
+	DefaultSender    = "Preview <preview@example.com>"
+	DefaultRecipient = "Recipient <recipient@example.com>"
+)
+
+// Handler serves the preview pages of the email templates of a mailer:
+//
+//	GET /                        lists the templates, their fixtures, and the locales
+//	GET /templates/{name}        previews the template with its subject, html, and text
+//	GET /templates/{name}/html   the rendered html of the email
+//	GET /templates/{name}/text   the rendered text of the email
+//	GET /templates/{name}/source the raw MIME source of the email
+//
+// Every template route accepts the fixture and locale query parameters and the preview
+// page also accepts mobile=true to display the html in a mobile-width frame. Links are
+// relative so the handler can be mounted under a prefix with http.StripPrefix.
+type Handler struct {
+	mailer   *commo.Mailer
+	fixtures Fixtures
+	mux      *http.ServeMux
+
+	// The recipient of the preview messages; defaults to DefaultRecipient.
+	Recipient string
+}
+
+var _ http.Handler = &Handler{}
+
+// New creates a preview handler for the templates of the mailer; the mailer does not
+// need a backend since the emails are only rendered. Templates without fixtures are
+// rendered with nil data.
+func New(mailer *commo.Mailer, fixtures Fixtures) *Handler {
+	h := &Handler{mailer: mailer, fixtures: fixtures, mux: http.NewServeMux(), Recipient: DefaultRecipient}
+	h.mux.HandleFunc("GET /{$}", h.index)
+	h.mux.HandleFunc("GET /templates/{name}", h.preview)
+	h.mux.HandleFunc("GET /templates/{name}/html", h.html)
+	h.mux.HandleFunc("GET /templates/{name}/text", h.text)
+	h.mux.HandleFunc("GET /templates/{name}/source", h.source)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Data for the index page.
+type indexPage struct {
+	Templates []templateEntry
+	Locales   []string
+	Error     error
+}
+
+type templateEntry struct {
+	Name     string
+	Fixtures []string
+}
+
+// Data for the preview page of a template.
+type previewPage struct {
+	Name     string
+	Fixture  string
+	Fixtures []string
+	Locale   string
+	Locales  []string
+	Mobile   bool
+	Query    template.URL
+	Subject  string
+	Sender   string
+	To       string
+	Text     string
+	Error    error
+}
+
+func (h *Handler) index(w http.ResponseWriter, r *http.Request) {
+	templates := h.mailer.Templates()
+	if templates == nil {
+		http.Error(w, commo.ErrTemplatesNotLoaded.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := indexPage{Locales: templates.Locales(), Error: templates.LastError()}
+	for _, name := range templates.Names() {
+		page.Templates = append(page.Templates, templateEntry{Name: name, Fixtures: h.fixtures.Names(name)})
+	}
+	h.page(w, http.StatusOK, indexTemplate, page)
+}
+
+func (h *Handler) preview(w http.ResponseWriter, r *http.Request) {
+	msg, status, err := h.render(r)
+	if msg == nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	page := previewPage{
+		Name:     msg.name,
+		Fixture:  msg.fixture,
+		Fixtures: h.fixtures.Names(msg.name),
+		Locale:   msg.locale,
+		Locales:  h.mailer.Templates().Locales(),
+		Mobile:   r.URL.Query().Get("mobile") == "true",
+		Query:    template.URL(msg.query()),
+		Error:    err,
+	}
+
+	if err == nil {
+		page.Subject = msg.email.Subject
+		page.Sender = msg.email.From
+		page.To = msg.email.To[0]
+		page.Text = string(msg.email.Text)
+	}
+	h.page(w, status, previewTemplate, page)
+}
+
+func (h *Handler) html(w http.ResponseWriter, r *http.Request) {
+	msg, status, err := h.render(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(msg.email.HTML)
+}
+
+func (h *Handler) text(w http.ResponseWriter, r *http.Request) {
+	msg, status, err := h.render(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(msg.email.Text)
+}
+
+// The source is served as text so that browsers display it rather than download it.
+func (h *Handler) source(w http.ResponseWriter, r *http.Request) {
+	msg, status, err := h.render(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var source []byte
+	if source, err = msg.email.Bytes(); err != nil {
+		http.Error(w, fmt.Sprintf("could not create mime source: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(source)
+}
+
+// Writes the page to the response; the page is rendered into a buffer so that errors
+// can still be returned with the correct status.
+func (h *Handler) page(w http.ResponseWriter, status int, tmpl *template.Template, data any) {
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		http.Error(w, fmt.Sprintf("could not render preview page: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,162 @@
+package preview_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+	"go.rtnl.ai/commo/preview"
+)
+
+var files = fstest.MapFS{
+	"templates/welcome.html":    {Data: []byte(`<p>Hello {{ .Name }}, you have {{ .Count }} messages.</p>`)},
+	"templates/welcome.txt":     {Data: []byte(`{{ define "subject" }}Welcome {{ .Name }}{{ end }}Hello {{ .Name }}, you have {{ .Count }} messages.`)},
+	"templates/welcome.fr.html": {Data: []byte(`<p>Bonjour {{ .Name }}</p>`)},
+	"templates/welcome.fr.txt":  {Data: []byte(`{{ define "subject" }}Bienvenue {{ .Name }}{{ end }}Bonjour {{ .Name }}`)},
+	"templates/broken.html":     {Data: []byte(`<p>{{ .Missing.Field }}</p>`)},
+	"templates/broken.txt":      {Data: []byte(`{{ .Missing.Field }}`)},
+	"templates/notice.html":     {Data: []byte(`<p>Notice</p>`)},
+	"templates/notice.txt":      {Data: []byte(`Notice`)},
+	"fixtures.yaml": {Data: []byte(`
+welcome:
+  default:
+    Name: Tess
+    Count: 3
+  zero:
+    Name: Nobody
+    Count: 0
+broken:
+  default:
+    Name: Tess
+`)},
+	"fixtures.json": {Data: []byte(`{"welcome": {"default": {"Name": "Tess", "Count": 3}, "zero": {"Name": "Nobody", "Count": 0}}}`)},
+	"fixtures.toml": {Data: []byte(`[welcome.default]`)},
+}
+
+func TestLoadFixtures(t *testing.T) {
+	yaml, err := preview.LoadFixtures(files, "fixtures.yaml")
+	require.NoError(t, err, "could not load yaml fixtures")
+	require.Equal(t, []string{"default", "zero"}, yaml.Names("welcome"))
+	require.Empty(t, yaml.Names("notice"))
+
+	json, err := preview.LoadFixtures(files, "fixtures.json")
+	require.NoError(t, err, "could not load json fixtures")
+	require.Equal(t, []string{"default", "zero"}, json.Names("welcome"))
+
+	name, data, ok := yaml.Lookup("welcome", "")
+	require.True(t, ok)
+	require.Equal(t, "default", name)
+	require.Equal(t, map[string]any{"Name": "Tess", "Count": 3}, data)
+
+	name, data, ok = yaml.Lookup("notice", "")
+	require.True(t, ok, "templates without fixtures are rendered with nil data")
+	require.Empty(t, name)
+	require.Nil(t, data)
+
+	_, _, ok = yaml.Lookup("welcome", "missing")
+	require.False(t, ok)
+
+	_, err = preview.LoadFixtures(files, "fixtures.toml")
+	require.ErrorIs(t, err, preview.ErrUnknownFormat)
+}
+
+func TestHandler(t *testing.T) {
+	templates, err := commo.LoadTemplates(files, commo.Layout{Dir: "templates", Locales: []string{"fr"}})
+	require.NoError(t, err, "could not load templates")
+
+	mailer, err := commo.NewMailer(commo.Config{Strict: true}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	fixtures, err := preview.LoadFixtures(files, "fixtures.yaml")
+	require.NoError(t, err, "could not load fixtures")
+
+	srv := httptest.NewServer(http.StripPrefix("/preview", preview.New(mailer, fixtures)))
+	defer srv.Close()
+
+	get := func(t *testing.T, path string) (int, string, string) {
+		rep, err := srv.Client().Get(srv.URL + "/preview" + path)
+		require.NoError(t, err, "could not make request")
+		defer rep.Body.Close()
+
+		body, err := io.ReadAll(rep.Body)
+		require.NoError(t, err, "could not read response")
+		return rep.StatusCode, rep.Header.Get("Content-Type"), string(body)
+	}
+
+	t.Run("Index", func(t *testing.T) {
+		status, ctype, body := get(t, "/")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "text/html; charset=utf-8", ctype)
+		require.Contains(t, body, `<a href="templates/welcome">welcome</a>`)
+		require.Contains(t, body, `<a href="templates/welcome?fixture=zero">zero</a>`)
+		require.Contains(t, body, `<a href="templates/notice">notice</a>`)
+		require.Contains(t, body, "Locales: fr")
+	})
+
+	t.Run("Preview", func(t *testing.T) {
+		status, _, body := get(t, "/templates/welcome?fixture=zero")
+		require.Equal(t, http.StatusOK, status)
+		require.Contains(t, body, "<td>Welcome Nobody</td>")
+		require.Contains(t, body, "<pre>Hello Nobody, you have 0 messages.</pre>")
+		require.Contains(t, body, `<iframe title="html" src="welcome/html?fixture=zero">`)
+		require.Contains(t, body, `<a href="welcome/source?fixture=zero">MIME source</a>`)
+		require.Contains(t, body, "<option selected>zero</option>")
+		require.NotContains(t, body, `class="mobile"`)
+
+		_, _, body = get(t, "/templates/welcome?fixture=zero&mobile=true&locale=fr")
+		require.Contains(t, body, `<iframe title="html" src="welcome/html?fixture=zero&amp;locale=fr" class="mobile">`)
+		require.Contains(t, body, "<td>Bienvenue Nobody</td>")
+		require.Contains(t, body, "<option selected>fr</option>")
+
+		// The default fixture is rendered if no fixture is selected.
+		_, _, body = get(t, "/templates/welcome")
+		require.Contains(t, body, "<td>Welcome Tess</td>")
+
+		// Templates without a subject or fixtures can still be previewed.
+		status, _, body = get(t, "/templates/notice")
+		require.Equal(t, http.StatusOK, status)
+		require.Contains(t, body, "<td>(no subject)</td>")
+	})
+
+	t.Run("Content", func(t *testing.T) {
+		status, ctype, body := get(t, "/templates/welcome/html?locale=fr")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "text/html; charset=utf-8", ctype)
+		require.Equal(t, "<p>Bonjour Tess</p>", body)
+
+		status, ctype, body = get(t, "/templates/welcome/text")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "text/plain; charset=utf-8", ctype)
+		require.Equal(t, "Hello Tess, you have 3 messages.", body)
+
+		status, _, body = get(t, "/templates/welcome/source")
+		require.Equal(t, http.StatusOK, status)
+		require.Contains(t, body, "Subject: Welcome Tess\r\n")
+		require.Contains(t, body, "From: \"Preview\" <preview@example.com>\r\n")
+		require.Contains(t, body, "To: \"Recipient\" <recipient@example.com>\r\n")
+		require.Contains(t, body, "Content-Type: multipart/alternative")
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		status, _, body := get(t, "/templates/unknown")
+		require.Equal(t, http.StatusNotFound, status)
+		require.Contains(t, body, `template "unknown" not found`)
+
+		status, _, body = get(t, "/templates/welcome?fixture=unknown")
+		require.Equal(t, http.StatusNotFound, status)
+		require.Contains(t, body, `fixture "unknown" of template "welcome" not found`)
+
+		// Rendering errors are displayed on the preview page.
+		status, _, body = get(t, "/templates/broken")
+		require.Equal(t, http.StatusInternalServerError, status)
+		require.Contains(t, body, `<div class="error">could not render template &#34;broken&#34;`)
+		require.Contains(t, body, "Missing")
+
+		status, _, _ = get(t, "/templates/broken/html")
+		require.Equal(t, http.StatusInternalServerError, status)
+	})
+}
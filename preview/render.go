@@ -0,0 +1,87 @@
+package preview
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/jordan-wright/email"
+	"go.rtnl.ai/commo"
+)
+
+// NoSubject is the subject of the preview message if the template does not declare a
+// subject block, since the subject is otherwise supplied by the caller of New.
+const NoSubject = "(no subject)"
+
+// A message rendered for the preview of a template with a fixture and locale.
+type message struct {
+	name    string
+	fixture string
+	locale  string
+	email   *email.Email
+}
+
+// Render the template of the request with the same path that is used to send emails
+// over SMTP so that the preview matches the message that is delivered. If the message
+// is nil the request is invalid; otherwise the error is a rendering error that can be
+// displayed on the preview page.
+func (h *Handler) render(r *http.Request) (msg *message, status int, err error) {
+	templates := h.mailer.Templates()
+	if templates == nil {
+		return nil, http.StatusInternalServerError, commo.ErrTemplatesNotLoaded
+	}
+
+	name := r.PathValue("name")
+	if !slices.Contains(templates.Names(), name) {
+		return nil, http.StatusNotFound, fmt.Errorf("template %q not found", name)
+	}
+
+	query := r.URL.Query()
+	msg = &message{name: name, locale: commo.NormalizeLocale(query.Get("locale"))}
+
+	var (
+		data any
+		ok   bool
+	)
+
+	if msg.fixture, data, ok = h.fixtures.Lookup(name, query.Get("fixture")); !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("fixture %q of template %q not found", query.Get("fixture"), name)
+	}
+
+	mailer := h.mailer
+	if msg.locale != "" {
+		mailer = mailer.Localized(msg.locale)
+	}
+
+	var e *commo.Email
+	if e, err = mailer.New(h.Recipient, "", name, data); err != nil {
+		return msg, http.StatusInternalServerError, err
+	}
+
+	if e.Sender == "" {
+		e.Sender = DefaultSender
+	}
+
+	if e.Subject == "" {
+		e.Subject = NoSubject
+	}
+
+	if msg.email, err = e.ToSMTP(); err != nil {
+		return msg, http.StatusInternalServerError, err
+	}
+	return msg, http.StatusOK, nil
+}
+
+// The query parameters that select the fixture and locale of the links of a page.
+func (m *message) query() string {
+	query := url.Values{}
+	if m.fixture != "" {
+		query.Set("fixture", m.fixture)
+	}
+
+	if m.locale != "" {
+		query.Set("locale", m.locale)
+	}
+	return query.Encode()
+}
@@ -0,0 +1,244 @@
+package commo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultQueueSize is the number of emails that can wait in a queue to be sent if the
+// size is not configured.
+const DefaultQueueSize = 1024
+
+// Queue sends emails asynchronously with a pool of workers so that callers such as API
+// handlers do not block while an email is delivered and retried. The queue is bounded:
+// Enqueue blocks when the queue is full and TryEnqueue fails, which applies backpressure
+// to the callers. Shutdown stops accepting emails and waits for the queue to drain.
+type Queue struct {
+	mailer  *Mailer
+	report  func(*Delivery)
+	queue   chan *Delivery
+	closing chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	once    sync.Once
+
+	mu        sync.Mutex
+	closed    bool
+	unsent    []*Delivery
+	enqueuers sync.WaitGroup
+	workers   sync.WaitGroup
+}
+
+// Delivery is the handle of an email that was enqueued; it is completed with the
+// result of sending the email once the queue has delivered it or given up.
+type Delivery struct {
+	email *Email
+	msg   *Message
+	done  chan struct{}
+	err   error
+}
+
+// NewQueue starts the workers of a send queue that delivers emails with the backend of
+// the mailer; if the mailer is nil the default mailer is used. The size of the queue and
+// the number of workers are read from the Queue configuration of the mailer; by default
+// there is one worker for every connection in the SMTP pool. If report is not nil it is
+// called by a worker with every delivery once it is complete, so it should not block.
+func NewQueue(mailer *Mailer, report func(*Delivery)) *Queue {
+	if mailer == nil {
+		mailer = defaultMailer()
+	}
+
+	size := mailer.conf.Queue.Size
+	if size < 1 {
+		size = DefaultQueueSize
+	}
+
+	workers := mailer.conf.Queue.Workers
+	if workers < 1 {
+		workers = max(mailer.conf.SMTP.PoolSize, 1)
+	}
+
+	q := &Queue{
+		mailer:  mailer,
+		report:  report,
+		queue:   make(chan *Delivery, size),
+		closing: make(chan struct{}),
+	}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+
+	q.workers.Add(workers)
+	for range workers {
+		go q.run()
+	}
+	return q
+}
+
+// Enqueue prepares the email and adds it to the queue to be sent, blocking until there
+// is room in the queue or the context is done. Validation and rendering errors are
+// returned immediately rather than reported with the delivery. The email is rendered
+// with the templates of the mailer of the queue when it is enqueued, so it is not used
+// by the queue afterwards.
+func (q *Queue) Enqueue(ctx context.Context, email *Email) (_ *Delivery, err error) {
+	var d *Delivery
+	if d, err = q.prepare(email); err != nil {
+		return nil, err
+	}
+	defer q.enqueuers.Done()
+
+	select {
+	case q.queue <- d:
+		return d, nil
+	case <-q.closing:
+		return nil, ErrQueueClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TryEnqueue is like Enqueue but returns ErrQueueFull rather than blocking if there is
+// no room in the queue, e.g. so that an API handler can shed load.
+func (q *Queue) TryEnqueue(email *Email) (_ *Delivery, err error) {
+	var d *Delivery
+	if d, err = q.prepare(email); err != nil {
+		return nil, err
+	}
+	defer q.enqueuers.Done()
+
+	select {
+	case q.queue <- d:
+		return d, nil
+	default:
+		return nil, ErrQueueFull
+	}
+}
+
+// Prepares the delivery of the email and registers the caller as an enqueuer so that
+// the queue is not closed while the delivery is being added to it.
+func (q *Queue) prepare(email *Email) (_ *Delivery, err error) {
+	if q.mailer.backend == nil {
+		return nil, ErrNotInitialized
+	}
+
+	d := &Delivery{email: email, done: make(chan struct{})}
+	if d.msg, err = q.mailer.prepare(email); err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+
+	q.enqueuers.Add(1)
+	return d, nil
+}
+
+// Len returns the number of emails waiting in the queue to be sent.
+func (q *Queue) Len() int {
+	return len(q.queue)
+}
+
+// Shutdown stops accepting emails and waits until the emails in the queue have been
+// sent. If the context is done first, the retries in progress are stopped and the
+// deliveries that were not sent are returned along with the context error so that the
+// caller can store their messages and send them later.
+func (q *Queue) Shutdown(ctx context.Context) (unsent []*Delivery, err error) {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.closing)
+	}
+	q.mu.Unlock()
+
+	// Once no more emails can be added the workers stop when the queue is drained.
+	q.enqueuers.Wait()
+	q.once.Do(func() { close(q.queue) })
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// Stops the retries in progress; the workers record the remaining emails as unsent.
+	q.cancel()
+	<-done
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.unsent, err
+}
+
+func (q *Queue) run() {
+	defer q.workers.Done()
+	for d := range q.queue {
+		q.deliver(d)
+	}
+}
+
+// Sends the prepared message of the delivery unless the queue has been cancelled by
+// Shutdown, in which case the delivery is recorded as unsent.
+func (q *Queue) deliver(d *Delivery) {
+	if err := q.ctx.Err(); err != nil {
+		d.err = fmt.Errorf("email was not sent: %w", ErrQueueClosed)
+	} else {
+		d.err = q.mailer.send(q.ctx, d.msg)
+	}
+
+	if d.err != nil && q.ctx.Err() != nil {
+		q.mu.Lock()
+		q.unsent = append(q.unsent, d)
+		q.mu.Unlock()
+	}
+
+	close(d.done)
+	if q.report != nil {
+		q.report(d)
+	}
+}
+
+// Email returns the email that was enqueued.
+func (d *Delivery) Email() *Email {
+	return d.email
+}
+
+// Message returns the prepared message that is delivered, e.g. to store it if it was
+// not sent before the queue was shut down.
+func (d *Delivery) Message() *Message {
+	return d.msg
+}
+
+// Done returns a channel that is closed when the delivery is complete.
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err returns the result of the delivery once Done is closed; it returns nil while the
+// email is still waiting to be sent.
+func (d *Delivery) Err() error {
+	select {
+	case <-d.done:
+		return d.err
+	default:
+		return nil
+	}
+}
+
+// Wait blocks until the delivery is complete and returns its result, or returns the
+// context error if the context is done first; the email is still sent by the queue.
+func (d *Delivery) Wait(ctx context.Context) error {
+	select {
+	case <-d.done:
+		return d.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,214 @@
+package commo_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+func TestQueue(t *testing.T) {
+	mailer, err := commo.NewMailer(commo.Config{Sender: "test@example.com", Testing: true}, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+
+	results := make(chan *commo.Delivery, 8)
+	queue := commo.NewQueue(mailer, func(d *commo.Delivery) { results <- d })
+
+	deliveries := make([]*commo.Delivery, 0, 8)
+	for range 8 {
+		email, err := mailer.New("tess@example.com", "Queued", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		d, err := queue.Enqueue(context.Background(), email)
+		require.NoError(t, err, "could not enqueue email")
+		deliveries = append(deliveries, d)
+	}
+
+	for _, d := range deliveries {
+		require.NoError(t, d.Wait(context.Background()), "expected email to be sent")
+		require.NoError(t, d.Err())
+		require.Equal(t, "Queued", d.Message().Subject())
+	}
+
+	unsent, err := queue.Shutdown(context.Background())
+	require.NoError(t, err, "could not shutdown queue")
+	require.Empty(t, unsent)
+	require.Len(t, mailer.Mock().Outbox(), 8)
+	require.Len(t, results, 8, "expected every delivery to be reported")
+
+	// Emails cannot be enqueued after the queue is shut down.
+	email, err := mailer.New("tess@example.com", "Late", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+
+	_, err = queue.Enqueue(context.Background(), email)
+	require.ErrorIs(t, err, commo.ErrQueueClosed)
+
+	// Invalid emails are not enqueued.
+	queue = commo.NewQueue(mailer, nil)
+	email, err = mailer.New("tess@example.com", "", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+
+	_, err = queue.Enqueue(context.Background(), email)
+	require.ErrorIs(t, err, commo.ErrMissingSubject)
+
+	// Emails are rendered with the templates of the mailer of the queue.
+	templates, err := commo.LoadTemplates(fstest.MapFS{
+		"test_email.html": {Data: []byte(`<p>Other</p>`)},
+		"test_email.txt":  {Data: []byte(`Other`)},
+	}, commo.DefaultLayout)
+	require.NoError(t, err, "could not load templates")
+
+	other, err := commo.NewMailer(commo.Config{Sender: "test@example.com", Testing: true}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	email, err = other.New("tess@example.com", "Other", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+
+	d, err := queue.Enqueue(context.Background(), email)
+	require.NoError(t, err, "could not enqueue email")
+	require.NoError(t, d.Wait(context.Background()), "expected email to be sent")
+	require.Contains(t, string(d.Message().Text()), "Hello", "expected the templates of the queue mailer")
+	require.Empty(t, other.Mock().Outbox(), "expected the backend of the queue mailer")
+
+	_, err = queue.Shutdown(context.Background())
+	require.NoError(t, err)
+}
+
+func TestQueueBackpressure(t *testing.T) {
+	conf := commo.Config{
+		Sender:  "test@example.com",
+		Backoff: fastBackoff(),
+		Queue:   commo.QueueConfig{Size: 1, Workers: 1},
+	}
+
+	var sending atomic.Int32
+	release := make(chan struct{})
+	backend := backendFunc(func(context.Context, *commo.Message) error {
+		sending.Add(1)
+		<-release
+		return nil
+	})
+
+	mailer, err := commo.NewMailerWithBackend(conf, backend, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+	queue := commo.NewQueue(mailer, nil)
+
+	enqueue := func() (*commo.Delivery, error) {
+		email, err := mailer.New("tess@example.com", "Queued", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		return queue.TryEnqueue(email)
+	}
+
+	// The first email is taken by the worker and the second fills the queue.
+	first, err := enqueue()
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return sending.Load() == 1 }, time.Second, time.Millisecond)
+
+	second, err := enqueue()
+	require.NoError(t, err)
+	require.Equal(t, 1, queue.Len())
+
+	_, err = enqueue()
+	require.ErrorIs(t, err, commo.ErrQueueFull)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	email, err := mailer.New("tess@example.com", "Blocked", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+
+	_, err = queue.Enqueue(ctx, email)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "expected enqueue to block while the queue is full")
+	require.Nil(t, first.Err(), "expected the delivery to be in progress")
+
+	// Shutdown drains the queue once the backend is released.
+	close(release)
+	unsent, err := queue.Shutdown(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, unsent)
+	require.NoError(t, first.Err())
+	require.NoError(t, second.Err())
+	require.Equal(t, int32(2), sending.Load())
+}
+
+func TestQueueWorkers(t *testing.T) {
+	conf := commo.Config{
+		Sender:  "test@example.com",
+		SMTP:    commo.SMTPConfig{PoolSize: 3},
+		Backoff: fastBackoff(),
+	}
+
+	var sending atomic.Int32
+	release := make(chan struct{})
+	backend := backendFunc(func(context.Context, *commo.Message) error {
+		sending.Add(1)
+		<-release
+		return nil
+	})
+
+	mailer, err := commo.NewMailerWithBackend(conf, backend, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+	queue := commo.NewQueue(mailer, nil)
+
+	for range 5 {
+		email, err := mailer.New("tess@example.com", "Queued", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		_, err = queue.Enqueue(context.Background(), email)
+		require.NoError(t, err)
+	}
+
+	// By default there is one worker for every connection of the smtp pool.
+	require.Eventually(t, func() bool { return sending.Load() == 3 }, time.Second, time.Millisecond)
+	require.Never(t, func() bool { return sending.Load() > 3 }, 20*time.Millisecond, time.Millisecond)
+
+	close(release)
+	_, err = queue.Shutdown(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int32(5), sending.Load())
+}
+
+func TestQueueShutdownDeadline(t *testing.T) {
+	conf := commo.Config{
+		Sender:  "test@example.com",
+		Backoff: fastBackoff(),
+		Queue:   commo.QueueConfig{Workers: 1},
+	}
+
+	// The retries must be stopped by the shutdown rather than the maximum elapsed time.
+	conf.Backoff.MaxElapsedTime = time.Minute
+
+	backend := backendFunc(func(context.Context, *commo.Message) error {
+		return errors.New("service unavailable")
+	})
+
+	mailer, err := commo.NewMailerWithBackend(conf, backend, loadTestTemplates())
+	require.NoError(t, err, "could not create mailer")
+	queue := commo.NewQueue(mailer, nil)
+
+	for range 3 {
+		email, err := mailer.New("tess@example.com", "Queued", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		_, err = queue.Enqueue(context.Background(), email)
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	unsent, err := queue.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, unsent, 3, "expected the emails that were not sent to be returned")
+
+	require.ErrorIs(t, unsent[0].Err(), context.Canceled, "expected the retries in progress to be stopped")
+	for _, d := range unsent[1:] {
+		require.ErrorIs(t, d.Err(), commo.ErrQueueClosed)
+		require.Equal(t, "Queued", d.Message().Subject(), "expected the message to be available to store")
+	}
+}
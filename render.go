@@ -3,51 +3,268 @@ package commo
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 // Render returns the text and html executed templates for the specified name
-// and data. Ensure that the extension is not supplied to the render method.
+// and data using the default mailer. Ensure that the extension is not supplied
+// to the render method.
 func Render(name string, data any) (text, html []byte, err error) {
-	if text, err = render(name+".txt", data); err != nil {
+	return defaultMailer().Render(name, data)
+}
+
+// Render returns the text and html executed templates as strings for the
+// specified name and data using the default mailer. Ensure that the extension
+// is not supplied to the render method.
+func RenderString(name string, data any) (text, html string, err error) {
+	return defaultMailer().RenderString(name, data)
+}
+
+// Render returns the text and html executed templates of the mailer for the
+// specified name and data. Ensure that the extension is not supplied to the
+// render method. If the mailer is localized, the most specific localized variant
+// of the template is rendered with the functions of the locale.
+func (m *Mailer) Render(name string, data any) (text, html []byte, err error) {
+	return m.render(name, m.locale, data)
+}
+
+func (m *Mailer) render(name, locale string, data any) (text, html []byte, err error) {
+	if m.templs == nil {
+		return nil, nil, ErrTemplatesNotLoaded
+	}
+
+	set, name := m.templs.resolve(name, locale)
+	tt, ok := set.Text[name]
+	if !ok && !m.templs.GenerateText {
+		return nil, nil, templateNotFound(name + TextExt)
+	}
+
+	ht, ok := set.HTML[name]
+	if !ok {
+		return nil, nil, templateNotFound(name + HTMLExt)
+	}
+
+	if html, err = execute(name, ht, data); err != nil {
 		return nil, nil, err
 	}
 
-	if html, err = render(name+".html", data); err != nil {
+	if m.templs.InlineCSS {
+		if html, err = InlineCSS(html); err != nil {
+			return nil, nil, fmt.Errorf("could not inline css for %q: %w", name, err)
+		}
+	}
+
+	// Generate the text from the html if the template has no text counterpart.
+	if tt == nil {
+		if text, err = HTMLToText(html); err != nil {
+			return nil, nil, fmt.Errorf("could not generate text for %q: %w", name, err)
+		}
+		return text, html, nil
+	}
+
+	if text, err = execute(name, tt, data); err != nil {
 		return nil, nil, err
 	}
 
 	return text, html, nil
 }
 
-// Render returns the text and html executed templates as strings for the
-// specified name and data. Ensure that the extension is not supplied to the
-// render method.
-func RenderString(name string, data any) (text, html string, err error) {
+// RenderString returns the text and html executed templates of the mailer as strings
+// for the specified name and data. Ensure that the extension is not supplied to
+// the render method.
+func (m *Mailer) RenderString(name string, data any) (text, html string, err error) {
 	var (
 		tb []byte
 		hb []byte
 	)
 
-	if tb, hb, err = Render(name, data); err != nil {
-		return "", "", nil
+	if tb, hb, err = m.Render(name, data); err != nil {
+		return "", "", err
 	}
 
 	return string(tb), string(hb), nil
 }
 
-func render(name string, data any) (_ []byte, err error) {
-	if templs == nil {
-		return nil, ErrTemplatesNotLoaded
-	}
+// Returns the error for a template file that is not in the templates; sending the
+// email again will not succeed so the error is not retried.
+func templateNotFound(file string) error {
+	return fmt.Errorf("could not find %q in templates: %w", file, ErrTemplateNotFound)
+}
 
-	t, ok := templs[name]
-	if !ok {
-		return nil, fmt.Errorf("could not find %q in templates", name)
-	}
+// The text and html templates share the Execute method signature.
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
 
+func execute(name string, t executor, data any) (_ []byte, err error) {
 	buf := &bytes.Buffer{}
 	if err = t.Execute(buf, data); err != nil {
-		return nil, err
+		return nil, newTemplateError(name, err, data, func(data any) error {
+			return t.Execute(io.Discard, data)
+		})
 	}
 	return buf.Bytes(), nil
 }
+
+// The maximum number of missing keys that are collected after a template fails to
+// execute in strict mode; each key requires the template to be executed again.
+const maxMissingKeys = 64
+
+var (
+	execLocation = regexp.MustCompile(`template: (.+):(\d+):(\d+): `)
+	execMissing  = regexp.MustCompile(`(?:map has|nil data;) no entry for key "((?:[^"\\]|\\.)*)"`)
+)
+
+// TemplateError is returned when an email template fails to execute. It describes the
+// location in the template files where execution failed and, when the templates are
+// strict (see Config.Strict), every key that is missing from the map data. It matches
+// ErrMissingKey with errors.Is if any keys are missing.
+type TemplateError struct {
+	Template string   // the name of the email template, e.g. welcome or welcome.fr
+	File     string   // the file where execution failed, e.g. welcome.html or base.html
+	Line     int      // the line in the file, starting at 1
+	Column   int      // the column in the line, starting at 1
+	Missing  []string // the keys that are missing from the map data, in order of execution
+	Err      error    // the error returned by the template
+}
+
+func (e *TemplateError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "could not render template %q", e.Template)
+	if e.File != "" {
+		fmt.Fprintf(&b, " at %s:%d:%d", e.File, e.Line, e.Column)
+	}
+
+	if len(e.Missing) > 0 {
+		fmt.Fprintf(&b, ": %s: %s", ErrMissingKey, strings.Join(e.Missing, ", "))
+		return b.String()
+	}
+
+	// The location is already part of the message so it is not repeated.
+	msg := e.Err.Error()
+	if loc := execLocation.FindStringIndex(msg); loc != nil && loc[0] == 0 {
+		msg = msg[loc[1]:]
+	}
+	fmt.Fprintf(&b, ": %s", msg)
+	return b.String()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TemplateError) Is(target error) bool {
+	return target == ErrMissingKey && len(e.Missing) > 0
+}
+
+// Wraps an execution error with the name of the template and its location. If a key
+// is missing from map data, the template is executed again with a copy of the data
+// that has the missing keys added as zero values to collect every missing key.
+func newTemplateError(name string, err error, data any, exec func(any) error) *TemplateError {
+	terr := &TemplateError{Template: name, Err: err}
+	if loc := execLocation.FindStringSubmatch(err.Error()); loc != nil {
+		terr.File = loc[1]
+		terr.Line, _ = strconv.Atoi(loc[2])
+		terr.Column, _ = strconv.Atoi(loc[3])
+	}
+
+	// Keys are collected from an empty map if there is no data.
+	value := copyMaps(reflect.ValueOf(data))
+	if !value.IsValid() {
+		value = reflect.ValueOf(map[string]any{})
+	}
+
+	for len(terr.Missing) < maxMissingKeys {
+		key, ok := missingKey(err)
+		if !ok || containsString(terr.Missing, key) {
+			break
+		}
+
+		terr.Missing = append(terr.Missing, key)
+		addKey(value, key)
+		if err = exec(value.Interface()); err == nil {
+			break
+		}
+	}
+	return terr
+}
+
+// Returns the key that is missing from map data if the error is a missing key error.
+func missingKey(err error) (string, bool) {
+	match := execMissing.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", false
+	}
+
+	key, uerr := strconv.Unquote(`"` + match[1] + `"`)
+	if uerr != nil {
+		return match[1], true
+	}
+	return key, true
+}
+
+// Returns a deep copy of the maps and slices in the value so that keys can be added to
+// the maps without modifying the data; nil maps are copied as empty maps. Structs and
+// pointers are not copied.
+func copyMaps(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyMaps(v.Elem()))
+		return c
+	case reflect.Map:
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(copyMaps(iter.Value()))
+			c.SetMapIndex(iter.Key(), elem)
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyMaps(v.Index(i)))
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// Adds the key with a zero value to every map with string keys in the value that does
+// not have the key, since the error does not identify which map is missing it.
+func addKey(v reflect.Value, key string) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			addKey(v.Elem(), key)
+		}
+	case reflect.Map:
+		for iter := v.MapRange(); iter.Next(); {
+			addKey(iter.Value(), key)
+		}
+
+		if v.Type().Key().Kind() == reflect.String {
+			k := reflect.ValueOf(key).Convert(v.Type().Key())
+			if !v.MapIndex(k).IsValid() {
+				v.SetMapIndex(k, reflect.Zero(v.Type().Elem()))
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			addKey(v.Index(i), key)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package commo_test
 
 import (
+	"errors"
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/require"
 	"go.rtnl.ai/commo"
@@ -22,7 +24,115 @@ func TestRender(t *testing.T) {
 func TestRenderUnknown(t *testing.T) {
 	commo.WithTemplates(loadTestTemplates())
 	_, _, err := commo.Render("foo", nil)
-	require.EqualError(t, err, "could not find \"foo.txt\" in templates", "expected unknown template")
+	require.EqualError(t, err, "could not find \"foo.txt\" in templates: template does not exist", "expected unknown template")
+	require.ErrorIs(t, err, commo.ErrTemplateNotFound)
+
+	_, _, err = commo.RenderString("foo", nil)
+	require.EqualError(t, err, "could not find \"foo.txt\" in templates: template does not exist", "expected unknown template")
+}
+
+func TestRenderEscaping(t *testing.T) {
+	commo.WithTemplates(loadTestTemplates())
+	data := struct{ ContactName string }{ContactName: "Tess O'Brien & <Sons>"}
+
+	// The text body contains the literal data while the html body is escaped.
+	text, html, err := commo.RenderString("test_email", data)
+	require.NoError(t, err, "could not render test_email")
+	require.Contains(t, text, "Hello Tess O'Brien & <Sons>,")
+	require.Contains(t, html, "Hello Tess O&#39;Brien &amp; &lt;Sons&gt;,")
+}
+
+func TestRenderStrict(t *testing.T) {
+	fsys := fstest.MapFS{
+		"partials/base.html": {Data: []byte(`{{ define "base" }}<h1>{{ .Title }}</h1>{{ block "content" . }}{{ end }}{{ end }}`)},
+		"order.html": {Data: []byte(`{{ template "base" . }}
+{{ define "content" }}<p>Hi {{ .Contact.Name }},</p>
+{{ range .Items }}<p>{{ .SKU }} x {{ .Quantity }}</p>{{ end }}
+<p>{{ .Total }}</p>{{ end }}`)},
+		"order.txt":   {Data: []byte(`{{ define "subject" }}Order {{ .Reference }}{{ end }}{{ .Title }}`)},
+		"struct.html": {Data: []byte(`{{ .Name }}`)},
+		"struct.txt":  {Data: []byte(`{{ .Name }}`)},
+	}
+
+	templates, err := commo.LoadTemplates(fsys, commo.DefaultLayout)
+	require.NoError(t, err, "could not load templates")
+
+	m, err := commo.NewMailer(commo.Config{Strict: true}, templates)
+	require.NoError(t, err, "could not create strict mailer")
+
+	data := map[string]any{
+		"Title":     "Your order",
+		"Reference": "A-1234",
+		"Contact":   map[string]string{"Name": "Tess Tester"},
+		"Items":     []map[string]any{{"SKU": "ABC", "Quantity": 2}},
+		"Total":     "$12.00",
+	}
+
+	_, html, err := m.Render("order", data)
+	require.NoError(t, err, "could not render complete data")
+	require.Contains(t, string(html), "Hi Tess Tester,")
+	require.NotContains(t, string(html), "<no value>")
+
+	t.Run("Missing", func(t *testing.T) {
+		partial := map[string]any{
+			"Contact": map[string]string{},
+			"Items":   []map[string]any{{"SKU": "ABC"}},
+		}
+
+		_, _, err := m.Render("order", partial)
+		require.ErrorIs(t, err, commo.ErrMissingKey)
+
+		var terr *commo.TemplateError
+		require.True(t, errors.As(err, &terr), "expected a template error")
+		require.Equal(t, "order", terr.Template)
+		require.Equal(t, "base.html", terr.File)
+		require.Equal(t, 1, terr.Line)
+		require.Equal(t, []string{"Title", "Name", "Quantity", "Total"}, terr.Missing)
+		require.EqualError(t, err, `could not render template "order" at base.html:1:26: template data is missing keys referenced by the template: Title, Name, Quantity, Total`)
+
+		// The data is not modified to find the missing keys.
+		require.Len(t, partial, 2)
+		require.Empty(t, partial["Contact"])
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		_, _, err := m.Render("order", nil)
+		require.ErrorIs(t, err, commo.ErrMissingKey)
+
+		var terr *commo.TemplateError
+		require.True(t, errors.As(err, &terr), "expected a template error")
+		require.Equal(t, []string{"Title", "Contact"}, terr.Missing)
+	})
+
+	t.Run("Metadata", func(t *testing.T) {
+		_, err := m.New("test@example.com", "", "order", map[string]any{"Title": "Your order"})
+		require.ErrorIs(t, err, commo.ErrMissingKey)
+		require.ErrorContains(t, err, "order.txt:1:31")
+		require.ErrorContains(t, err, "keys referenced by the template: Reference")
+	})
+
+	t.Run("Struct", func(t *testing.T) {
+		_, _, err := m.Render("struct", struct{ Title string }{})
+		require.Error(t, err, "expected missing struct fields to fail")
+		require.NotErrorIs(t, err, commo.ErrMissingKey)
+
+		var terr *commo.TemplateError
+		require.True(t, errors.As(err, &terr), "expected a template error")
+		require.Equal(t, "struct.html", terr.File)
+		require.Contains(t, err.Error(), `could not render template "struct" at struct.html:1:3: executing "struct.html" at <.Name>: can't evaluate field Name`)
+	})
+
+	t.Run("NotStrict", func(t *testing.T) {
+		templates, err := commo.LoadTemplates(fsys, commo.DefaultLayout)
+		require.NoError(t, err, "could not load templates")
+
+		m, err := commo.NewMailer(commo.Config{}, templates)
+		require.NoError(t, err, "could not create mailer")
+
+		text, _, err := m.Render("order", map[string]any{"Contact": map[string]string{}})
+		require.NoError(t, err, "missing keys should not fail when not strict")
+		require.Equal(t, "<no value>", string(text))
+	})
 }
 
 func allEmailTemplates(t *testing.T) []string {
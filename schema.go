@@ -0,0 +1,527 @@
+package commo
+
+import (
+	"fmt"
+	"html/template"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// Problem kinds that are reported when checking templates against their data types.
+const (
+	MissingField    = "missing field"
+	TypeMismatch    = "type mismatch"
+	UnknownTemplate = "unknown template"
+)
+
+// SchemaProblem is a reference in a template that cannot be resolved against the
+// declared data type of the template, e.g. a field that the type does not have.
+type SchemaProblem struct {
+	Template string // the name of the email template, e.g. welcome or welcome.fr
+	File     string // the file that contains the reference, e.g. welcome.html or base.html
+	Line     int
+	Column   int
+	Field    string // the reference, e.g. .Contact.Name
+	Kind     string // MissingField, TypeMismatch, or UnknownTemplate
+	Message  string
+}
+
+func (p SchemaProblem) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%s: %s", p.Template, p.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", p.File, p.Line, p.Column, p.Field, p.Message)
+}
+
+// SchemaError is returned when templates do not execute cleanly against their declared
+// data types. It reports every problem found, sorted by template and location, and
+// matches ErrSchemaMismatch with errors.Is.
+type SchemaError struct {
+	Problems []SchemaProblem
+}
+
+func (e *SchemaError) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf("%s: %d problem(s) found", ErrSchemaMismatch, len(e.Problems)))
+	for _, p := range e.Problems {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n  ")
+}
+
+func (e *SchemaError) Is(target error) bool {
+	return target == ErrSchemaMismatch
+}
+
+// Templates returns the problems grouped by the name of the email template.
+func (e *SchemaError) Templates() map[string][]SchemaProblem {
+	templates := make(map[string][]SchemaProblem)
+	for _, p := range e.Problems {
+		templates[p.Template] = append(templates[p.Template], p)
+	}
+	return templates
+}
+
+// Check that the email templates execute cleanly against their declared data types,
+// keyed by the name of the template, e.g. {"welcome": WelcomeData{}}. The text, html,
+// and localized variants of each template and the templates and blocks that they
+// invoke are checked for fields that do not exist on the type and for fields, ranges,
+// and indexes that do not match the type. Values of interface types (e.g. the values
+// of a map[string]any) cannot be checked. Templates without a declared type are not
+// checked. Returns a *SchemaError if any problems are found.
+//
+// Check inspects the parsed templates, so it should be called at load time (see
+// Layout.Schemas) or in tests rather than concurrently with rendering.
+func (t *Templates) Check(schemas map[string]any) error {
+	t = t.current()
+	var problems []SchemaProblem
+	for name, data := range schemas {
+		var found bool
+		for _, set := range t.sets() {
+			for key := range set.HTML {
+				if base, _ := t.splitLocale(key); base != name && key != name {
+					continue
+				}
+
+				found = true
+				problems = append(problems, set.check(key, reflect.TypeOf(data))...)
+			}
+		}
+
+		if !found {
+			problems = append(problems, SchemaProblem{
+				Template: name,
+				Kind:     UnknownTemplate,
+				Message:  fmt.Sprintf("template %q does not exist", name),
+			})
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	problems = dedupeProblems(problems)
+	sort.Slice(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		if a.Template != b.Template {
+			return a.Template < b.Template
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Message < b.Message
+	})
+	return &SchemaError{Problems: problems}
+}
+
+// Returns the default templates and the templates of each locale; localized sets are
+// only returned for their localized templates since the default templates are the
+// same in every set.
+func (t *Templates) sets() []*Templates {
+	sets := []*Templates{t}
+	for _, locale := range t.Locales() {
+		localized := t.localized[locale]
+		only := &Templates{Text: localized.Text, HTML: make(map[string]*template.Template)}
+		for key, ht := range localized.HTML {
+			if _, tag := t.splitLocale(key); tag != "" {
+				only.HTML[key] = ht
+			}
+		}
+		sets = append(sets, only)
+	}
+	return sets
+}
+
+// Check the text and html templates with the key against the data type, including
+// the metadata blocks that are rendered with the same data.
+func (t *Templates) check(key string, data reflect.Type) (problems []SchemaProblem) {
+	type lookup struct {
+		root   *parse.Tree
+		lookup func(string) *parse.Tree
+	}
+
+	var trees []lookup
+	if tt, ok := t.Text[key]; ok {
+		trees = append(trees, lookup{tt.Tree, func(name string) *parse.Tree {
+			if tmpl := tt.Lookup(name); tmpl != nil {
+				return tmpl.Tree
+			}
+			return nil
+		}})
+	}
+
+	if ht, ok := t.HTML[key]; ok {
+		trees = append(trees, lookup{ht.Tree, func(name string) *parse.Tree {
+			if tmpl := ht.Lookup(name); tmpl != nil {
+				return tmpl.Tree
+			}
+			return nil
+		}})
+	}
+
+	for _, tree := range trees {
+		c := &checker{template: key, lookup: tree.lookup, visited: make(map[string]bool)}
+		c.tree(tree.root, data)
+
+		for _, block := range []string{SubjectBlock, PreheaderBlock, SenderBlock, TagsBlock} {
+			if bt := tree.lookup(block); bt != nil {
+				c.tree(bt, data)
+			}
+		}
+		problems = append(problems, c.problems...)
+	}
+	return problems
+}
+
+func dedupeProblems(problems []SchemaProblem) []SchemaProblem {
+	seen := make(map[SchemaProblem]struct{}, len(problems))
+	deduped := problems[:0]
+	for _, p := range problems {
+		if _, ok := seen[p]; !ok {
+			seen[p] = struct{}{}
+			deduped = append(deduped, p)
+		}
+	}
+	return deduped
+}
+
+// Walks the parse trees of a template tracking the type of dot and of the variables; a
+// nil type is unknown (e.g. an interface or the result of a function) and is not
+// checked further.
+type checker struct {
+	template string
+	lookup   func(string) *parse.Tree
+	visited  map[string]bool
+	problems []SchemaProblem
+	current  *parse.Tree
+}
+
+type scope map[string]reflect.Type
+
+func (s scope) copy() scope {
+	c := make(scope, len(s))
+	for k, v := range s {
+		c[k] = v
+	}
+	return c
+}
+
+// Check the tree with the type of dot; each tree is only checked once per type so
+// that recursive templates terminate.
+func (c *checker) tree(tree *parse.Tree, dot reflect.Type) {
+	if tree == nil || tree.Root == nil {
+		return
+	}
+
+	key := tree.Name + "\x00" + typeName(dot)
+	if c.visited[key] {
+		return
+	}
+	c.visited[key] = true
+
+	parent := c.current
+	c.current = tree
+	c.walk(tree.Root, dot, scope{"$": dot})
+	c.current = parent
+}
+
+func (c *checker) walk(node parse.Node, dot reflect.Type, vars scope) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.walk(child, dot, vars)
+		}
+	case *parse.ActionNode:
+		c.pipe(n.Pipe, dot, vars)
+	case *parse.IfNode:
+		c.pipe(n.Pipe, dot, vars)
+		c.walk(n.List, dot, vars.copy())
+		c.walk(n.ElseList, dot, vars.copy())
+	case *parse.WithNode:
+		typ := c.pipe(n.Pipe, dot, vars)
+		c.walk(n.List, typ, vars.copy())
+		c.walk(n.ElseList, dot, vars.copy())
+	case *parse.RangeNode:
+		c.rangeNode(n, dot, vars)
+	case *parse.TemplateNode:
+		var arg reflect.Type
+		if n.Pipe != nil {
+			arg = c.pipe(n.Pipe, dot, vars)
+		}
+		c.tree(c.lookup(n.Name), arg)
+	}
+}
+
+func (c *checker) rangeNode(n *parse.RangeNode, dot reflect.Type, vars scope) {
+	// The variables of the range are the key and element rather than the pipeline.
+	var typ reflect.Type
+	for _, cmd := range n.Pipe.Cmds {
+		typ = c.command(cmd, dot, vars)
+	}
+
+	key, elem, ok := rangeTypes(typ)
+	if !ok {
+		c.problem(n, n.Pipe.String(), TypeMismatch, fmt.Sprintf("cannot range over %s", typeName(typ)))
+	}
+
+	inner := vars.copy()
+	switch decl := n.Pipe.Decl; len(decl) {
+	case 1:
+		inner[decl[0].Ident[0]] = elem
+	case 2:
+		inner[decl[0].Ident[0]] = key
+		inner[decl[1].Ident[0]] = elem
+	}
+
+	c.walk(n.List, elem, inner)
+	c.walk(n.ElseList, dot, vars.copy())
+}
+
+// Returns the type of the pipeline and declares or assigns its variables.
+func (c *checker) pipe(pipe *parse.PipeNode, dot reflect.Type, vars scope) (typ reflect.Type) {
+	if pipe == nil {
+		return nil
+	}
+
+	for _, cmd := range pipe.Cmds {
+		typ = c.command(cmd, dot, vars)
+	}
+
+	for _, v := range pipe.Decl {
+		vars[v.Ident[0]] = typ
+	}
+	return typ
+}
+
+func (c *checker) command(cmd *parse.CommandNode, dot reflect.Type, vars scope) reflect.Type {
+	for _, arg := range cmd.Args[1:] {
+		c.arg(arg, dot, vars)
+	}
+
+	switch n := cmd.Args[0].(type) {
+	case *parse.IdentifierNode:
+		return c.function(n.Ident, cmd.Args[1:], dot, vars)
+	default:
+		return c.arg(n, dot, vars)
+	}
+}
+
+func (c *checker) arg(node parse.Node, dot reflect.Type, vars scope) reflect.Type {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return c.fields(n, n.String(), dot, n.Ident)
+	case *parse.VariableNode:
+		typ, ok := vars[n.Ident[0]]
+		if !ok {
+			return nil
+		}
+		return c.fields(n, n.String(), typ, n.Ident[1:])
+	case *parse.ChainNode:
+		return c.fields(n, n.String(), c.arg(n.Node, dot, vars), n.Field)
+	case *parse.PipeNode:
+		return c.pipe(n, dot, vars)
+	case *parse.StringNode:
+		return reflect.TypeFor[string]()
+	case *parse.BoolNode:
+		return reflect.TypeFor[bool]()
+	case *parse.NumberNode:
+		switch {
+		case n.IsInt:
+			return reflect.TypeFor[int]()
+		case n.IsFloat:
+			return reflect.TypeFor[float64]()
+		}
+	}
+	return nil
+}
+
+// Returns the result type of the builtin functions that are known; the result types
+// of other functions are unknown.
+func (c *checker) function(name string, args []parse.Node, dot reflect.Type, vars scope) reflect.Type {
+	switch name {
+	case "and", "or", "not", "eq", "ne", "lt", "le", "gt", "ge":
+		return reflect.TypeFor[bool]()
+	case "len":
+		return reflect.TypeFor[int]()
+	case "print", "printf", "println", "html", "js", "urlquery":
+		return reflect.TypeFor[string]()
+	case "index":
+		if len(args) == 0 {
+			return nil
+		}
+
+		typ := c.arg(args[0], dot, vars)
+		for range args[1:] {
+			if typ = indirect(typ); typ == nil {
+				return nil
+			}
+
+			switch typ.Kind() {
+			case reflect.Slice:
+				typ = addressable(typ.Elem())
+			case reflect.Array, reflect.Map:
+				typ = typ.Elem()
+			case reflect.String:
+				typ = reflect.TypeFor[byte]()
+			default:
+				c.problem(args[0], args[0].String(), TypeMismatch, fmt.Sprintf("cannot index %s", typeName(typ)))
+				return nil
+			}
+		}
+		return typ
+	default:
+		return nil
+	}
+}
+
+// Resolve the chain of fields, maps keys, and methods on the type.
+func (c *checker) fields(node parse.Node, ref string, typ reflect.Type, fields []string) reflect.Type {
+	for _, field := range fields {
+		if typ == nil {
+			return nil
+		}
+
+		// Methods are checked before fields; methods with pointer receivers are only
+		// in the method set of pointers and addressable values, like when executed.
+		if method, ok := typ.MethodByName(field); ok {
+			typ = methodResult(method.Type)
+			continue
+		}
+
+		base := indirect(typ)
+		if base == nil {
+			return nil
+		}
+
+		switch base.Kind() {
+		case reflect.Struct:
+			sf, ok := base.FieldByName(field)
+			switch {
+			case !ok:
+				c.problem(node, ref, MissingField, fmt.Sprintf("field %s does not exist in %s", field, typeName(base)))
+				return nil
+			case !sf.IsExported():
+				c.problem(node, ref, MissingField, fmt.Sprintf("field %s is unexported in %s", field, typeName(base)))
+				return nil
+			}
+
+			if typ.Kind() == reflect.Pointer {
+				typ = addressable(sf.Type)
+			} else {
+				typ = sf.Type
+			}
+		case reflect.Map:
+			if base.Key().Kind() != reflect.String {
+				c.problem(node, ref, TypeMismatch, fmt.Sprintf("cannot access key %s of %s", field, typeName(base)))
+				return nil
+			}
+			typ = base.Elem()
+		default:
+			c.problem(node, ref, TypeMismatch, fmt.Sprintf("cannot access field %s of %s", field, typeName(base)))
+			return nil
+		}
+	}
+	return typ
+}
+
+func (c *checker) problem(node parse.Node, ref, kind, message string) {
+	p := SchemaProblem{Template: c.template, Field: ref, Kind: kind, Message: message}
+
+	// The location is formatted as file:line:column.
+	location, _ := c.current.ErrorContext(node)
+	if parts := strings.Split(location, ":"); len(parts) >= 3 {
+		p.File = strings.Join(parts[:len(parts)-2], ":")
+		p.Line, _ = strconv.Atoi(parts[len(parts)-2])
+		p.Column, _ = strconv.Atoi(parts[len(parts)-1])
+	}
+	c.problems = append(c.problems, p)
+}
+
+// Returns the key and element types when ranging over the type.
+func rangeTypes(typ reflect.Type) (key, elem reflect.Type, ok bool) {
+	base := indirect(typ)
+	if base == nil {
+		return nil, nil, true
+	}
+
+	switch base.Kind() {
+	case reflect.Slice:
+		return reflect.TypeFor[int](), addressable(base.Elem()), true
+	case reflect.Array:
+		if typ.Kind() == reflect.Pointer {
+			return reflect.TypeFor[int](), addressable(base.Elem()), true
+		}
+		return reflect.TypeFor[int](), base.Elem(), true
+	case reflect.Map:
+		return base.Key(), base.Elem(), true
+	case reflect.Chan:
+		return nil, base.Elem(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return nil, base, true
+	case reflect.Func:
+		// Range over iterator functions, e.g. iter.Seq and iter.Seq2.
+		if base.NumIn() == 1 && base.In(0).Kind() == reflect.Func {
+			switch yield := base.In(0); yield.NumIn() {
+			case 1:
+				return nil, yield.In(0), true
+			case 2:
+				return yield.In(0), yield.In(1), true
+			}
+		}
+		return nil, nil, false
+	default:
+		return nil, nil, false
+	}
+}
+
+// Returns the type that pointers to the type point to, or nil for interfaces.
+func indirect(typ reflect.Type) reflect.Type {
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ != nil && typ.Kind() == reflect.Interface {
+		return nil
+	}
+	return typ
+}
+
+// The checker tracks an addressable value (e.g. a field of a struct that dot points to
+// or an element of a slice) as a pointer to its type, since like a pointer it has the
+// methods with pointer receivers.
+func addressable(typ reflect.Type) reflect.Type {
+	if typ == nil || typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Interface {
+		return typ
+	}
+	return reflect.PointerTo(typ)
+}
+
+func methodResult(method reflect.Type) reflect.Type {
+	if method.NumOut() == 0 {
+		return nil
+	}
+	return method.Out(0)
+}
+
+func typeName(typ reflect.Type) string {
+	if typ == nil {
+		return "unknown"
+	}
+	return typ.String()
+}
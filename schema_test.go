@@ -0,0 +1,152 @@
+package commo_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+type contactData struct {
+	ContactName string
+}
+
+type orderData struct {
+	Contact   *orderContact
+	Items     []orderItem
+	Totals    map[string]float64
+	PlacedAt  time.Time
+	Reference string
+}
+
+type orderContact struct {
+	Name  string
+	email string
+}
+
+type orderItem struct {
+	SKU      string
+	Quantity int
+}
+
+func (i orderItem) Label() string { return i.SKU }
+
+func (i *orderItem) Total() int { return i.Quantity }
+
+func TestCheckTestdata(t *testing.T) {
+	templates := loadTestTemplates()
+	err := templates.Check(map[string]any{
+		"test_email":   contactData{},
+		"inline_image": contactData{},
+		"invoice":      invoiceData{},
+	})
+	require.NoError(t, err, "expected the test templates to match their data types")
+
+	// A struct without the ContactName field renders a blank greeting.
+	err = templates.Check(map[string]any{"test_email": struct{ Name string }{}})
+	require.ErrorIs(t, err, commo.ErrSchemaMismatch)
+}
+
+func TestCheck(t *testing.T) {
+	fsys := fstest.MapFS{
+		"partials/base.html": {Data: []byte("{{ define \"base\" }}<h1>{{ .Contact.Nmae }}</h1>{{ block \"content\" . }}{{ end }}{{ end }}")},
+		"order.html": {Data: []byte(`{{ template "base" . }}
+{{ define "content" }}
+{{ range $i, $item := .Items }}<p>{{ $i }}: {{ $item.Label }} x {{ $item.Quantity }} {{ $item.Price }}</p>{{ end }}
+{{ with .Contact }}{{ .Name }} {{ .email }}{{ end }}
+{{ range .Reference }}{{ . }}{{ end }}
+{{ .Totals.tax }} {{ .Totals.tax.Amount }}
+{{ .PlacedAt.Format "2006-01-02" }} {{ .PlacedAt.Zone }}
+{{ index .Items 0 | printf "%v" }} {{ (index .Items 0).Sku }}
+{{ end }}`)},
+		"order.txt":          {Data: []byte(`{{ define "subject" }}Order {{ .Ref }}{{ end }}{{ .Reference }}`)},
+		"order.fr.html":      {Data: []byte(`{{ .Contact.Nom }}`)},
+		"order.fr.txt":       {Data: []byte(`{{ .Contact.Name }}`)},
+		"locales/fr.json":    {Data: []byte(`{}`)},
+		"unchecked.html":     {Data: []byte(`{{ .Anything }}`)},
+		"unchecked.txt":      {Data: []byte(`{{ .Anything }}`)},
+		"partials/base.txt":  {Data: []byte(`{{ define "base" }}{{ .Contact.Name }}{{ end }}`)},
+		"partials/other.txt": {Data: []byte(`{{ define "other" }}{{ .Missing }}{{ end }}`)},
+	}
+
+	templates, err := commo.LoadTemplates(fsys, commo.DefaultLayout)
+	require.NoError(t, err, "could not load templates")
+
+	err = templates.Check(map[string]any{"order": orderData{}, "receipt": orderData{}})
+	require.ErrorIs(t, err, commo.ErrSchemaMismatch)
+
+	var report *commo.SchemaError
+	require.True(t, errors.As(err, &report), "expected a schema error")
+
+	type problem struct {
+		file  string
+		line  int
+		field string
+		kind  string
+	}
+
+	actual := make(map[string][]problem)
+	for name, problems := range report.Templates() {
+		for _, p := range problems {
+			actual[name] = append(actual[name], problem{p.File, p.Line, p.Field, p.Kind})
+		}
+	}
+
+	require.Equal(t, map[string][]problem{
+		"order": {
+			{"base.html", 1, ".Contact.Nmae", commo.MissingField},
+			{"order.html", 3, "$item.Price", commo.MissingField},
+			{"order.html", 4, ".email", commo.MissingField},
+			{"order.html", 5, ".Reference", commo.TypeMismatch},
+			{"order.html", 6, ".Totals.tax.Amount", commo.TypeMismatch},
+			{"order.html", 8, "(index .Items 0).Sku", commo.MissingField},
+			{"order.txt", 1, ".Ref", commo.MissingField},
+		},
+		"order.fr": {
+			{"order.fr.html", 1, ".Contact.Nom", commo.MissingField},
+		},
+		"receipt": {
+			{"", 0, "", commo.UnknownTemplate},
+		},
+	}, actual)
+
+	require.Contains(t, err.Error(), "order.html:3:")
+	require.Contains(t, err.Error(), "$item.Price: field Price does not exist in commo_test.orderItem")
+
+	t.Run("Layout", func(t *testing.T) {
+		_, err := commo.LoadTemplates(fsys, commo.Layout{Schemas: map[string]any{"order": orderData{}}})
+		require.ErrorIs(t, err, commo.ErrSchemaMismatch)
+
+		_, err = commo.LoadTemplates(fsys, commo.Layout{Schemas: map[string]any{"unchecked": map[string]any{}}})
+		require.NoError(t, err, "expected interface values to be unchecked")
+	})
+}
+
+func TestCheckPointerMethods(t *testing.T) {
+	fsys := fstest.MapFS{
+		"item.html":  {Data: []byte(`{{ .Label }} {{ .Total }}`)},
+		"item.txt":   {Data: []byte(`{{ .Label }}`)},
+		"order.html": {Data: []byte(`{{ range .Items }}{{ .Total }}{{ end }} {{ (index .Items 0).Total }}`)},
+		"order.txt":  {Data: []byte(`{{ with .Contact }}{{ .Name }}{{ end }}`)},
+	}
+
+	templates, err := commo.LoadTemplates(fsys, commo.DefaultLayout)
+	require.NoError(t, err, "could not load templates")
+
+	// Pointer methods cannot be called on a struct that is passed by value.
+	err = templates.Check(map[string]any{"item": orderItem{}})
+	require.ErrorIs(t, err, commo.ErrSchemaMismatch)
+
+	var report *commo.SchemaError
+	require.True(t, errors.As(err, &report), "expected a schema error")
+	problems := report.Templates()["item"]
+	require.Len(t, problems, 1)
+	require.Equal(t, ".Total", problems[0].Field)
+	require.Equal(t, commo.MissingField, problems[0].Kind)
+
+	// Pointers and addressable values such as the elements of a slice have the methods.
+	require.NoError(t, templates.Check(map[string]any{"item": &orderItem{}, "order": orderData{}}))
+}
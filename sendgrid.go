@@ -1,11 +1,21 @@
 package commo
 
 import (
+	"context"
+	"net/http"
 	"net/mail"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/sendgrid/rest"
+	"github.com/sendgrid/sendgrid-go"
 	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
+// The path of the SendGrid v3 mail send API relative to the base url.
+const sendGridEndpoint = "/v3/mail/send"
+
 func NewSGEmail(email string) (_ *sgmail.Email, err error) {
 	var parsed *mail.Address
 	if parsed, err = mail.ParseAddress(email); err != nil {
@@ -41,3 +51,123 @@ func MustNewSGEmails(emails []string) []*sgmail.Email {
 	}
 	return addrs
 }
+
+// SendGridBackend delivers emails using the SendGrid v3 API.
+type SendGridBackend struct {
+	client  *sendgrid.Client
+	timeout time.Duration
+
+	mu        sync.RWMutex
+	rateLimit RateLimit
+}
+
+var _ Backend = &SendGridBackend{}
+
+// NewSendGridBackend creates a SendGrid API client from the configuration.
+func NewSendGridBackend(conf Config) (*SendGridBackend, error) {
+	return &SendGridBackend{
+		client:  conf.SendGrid.Client(),
+		timeout: conf.Backoff.Timeout,
+	}, nil
+}
+
+// Send the message using the SendGrid API, cancelling the request when the context is
+// done or the timeout of the configuration is exceeded; a non-2xx response is returned
+// as an error.
+func (b *SendGridBackend) Send(ctx context.Context, m *Message) (err error) {
+	var msg *sgmail.SGMailV3
+	if msg, err = m.ToSendGrid(); err != nil {
+		return Permanent(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	// The client stores the request body so a copy is used to allow concurrent sends.
+	client := *b.client
+
+	var rep *rest.Response
+	if rep, err = client.SendWithContext(ctx, msg); err != nil {
+		return err
+	}
+
+	if limit, ok := parseRateLimit(http.Header(rep.Headers)); ok {
+		b.mu.Lock()
+		b.rateLimit = limit
+		b.mu.Unlock()
+	}
+
+	if rep.StatusCode < 200 || rep.StatusCode >= 300 {
+		return newSendGridError(rep)
+	}
+
+	return nil
+}
+
+func (b *SendGridBackend) Name() string {
+	return "sendgrid"
+}
+
+// RateLimit returns the rate limit reported by the most recent SendGrid response that
+// included the rate limit headers, or the zero value if no response has included them.
+// Callers can use it to delay or shed emails before the limit is exceeded.
+func (b *SendGridBackend) RateLimit() RateLimit {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.rateLimit
+}
+
+// Close is a no-op since the SendGrid client does not hold any resources.
+func (b *SendGridBackend) Close() error {
+	return nil
+}
+
+// RateLimit is the state of the SendGrid rate limit from the X-RateLimit headers.
+type RateLimit struct {
+	Limit     int       // the number of requests allowed in the current window
+	Remaining int       // the number of requests remaining in the current window
+	Reset     time.Time // when the current window ends and the limit is reset
+}
+
+// Exceeded returns true if no requests remain before the rate limit is reset.
+func (r RateLimit) Exceeded() bool {
+	return r.Remaining <= 0 && time.Now().Before(r.Reset)
+}
+
+// Parses the X-RateLimit headers of a SendGrid response; ok is false if the response
+// does not include them.
+func parseRateLimit(header http.Header) (limit RateLimit, ok bool) {
+	var err error
+	if limit.Limit, err = strconv.Atoi(header.Get("X-RateLimit-Limit")); err != nil {
+		return RateLimit{}, false
+	}
+
+	if limit.Remaining, err = strconv.Atoi(header.Get("X-RateLimit-Remaining")); err != nil {
+		return RateLimit{}, false
+	}
+
+	var reset int64
+	if reset, err = strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err != nil {
+		return RateLimit{}, false
+	}
+
+	limit.Reset = time.Unix(reset, 0)
+	return limit, true
+}
+
+// Returns how long to wait before the request is retried, using the later of the
+// Retry-After header (in seconds or as an http date) and the X-RateLimit-Reset header.
+func retryAfter(header http.Header) (wait time.Duration) {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		} else if date, err := http.ParseTime(value); err == nil {
+			wait = time.Until(date)
+		}
+	}
+
+	if limit, ok := parseRateLimit(header); ok {
+		wait = max(wait, time.Until(limit.Reset))
+	}
+	return max(wait, 0)
+}
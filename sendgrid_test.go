@@ -1,11 +1,15 @@
 package commo_test
 
 import (
+	"context"
+	"net/http"
 	"testing"
+	"time"
 
 	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
 	"github.com/stretchr/testify/require"
 	"go.rtnl.ai/commo"
+	"go.rtnl.ai/commo/commotest"
 )
 
 func TestNewSGEmail(t *testing.T) {
@@ -103,3 +107,198 @@ func TestNewSGEmails(t *testing.T) {
 		}
 	})
 }
+
+func TestSendGridSend(t *testing.T) {
+	srv := commotest.NewSendGridServer()
+	srv.APIKey = "SG.testing"
+	t.Cleanup(srv.Close)
+
+	conf := commo.Config{
+		Sender:   "Jane Szack <jane@example.com>",
+		SendGrid: srv.Config(),
+		Backoff:  fastBackoff(),
+	}
+	conf.Backoff.Timeout = 100 * time.Millisecond
+	conf.Backoff.MaxElapsedTime = 500 * time.Millisecond
+
+	mailer, err := commo.NewMailer(conf, loadTestTemplates())
+	require.NoError(t, err, "could not create sendgrid mailer")
+	require.Equal(t, "sendgrid", mailer.Backend().Name())
+	t.Cleanup(func() { mailer.Close() })
+
+	t.Run("Send", func(t *testing.T) {
+		srv.Reset()
+		data := struct{ ContactName string }{ContactName: "Tess Tester"}
+		email, err := mailer.New("Tess Tester <tess@example.com>", "Test Subject", "test_email", data)
+		require.NoError(t, err, "could not create email")
+		require.NoError(t, email.Send(), "could not send email")
+
+		msgs := srv.Messages()
+		require.Len(t, msgs, 1)
+		require.Equal(t, &sgmail.Email{Name: "Jane Szack", Address: "jane@example.com"}, msgs[0].From)
+		require.Equal(t, "Test Subject", msgs[0].Subject)
+		require.Len(t, msgs[0].Personalizations, 1)
+		require.Equal(t, []*sgmail.Email{{Name: "Tess Tester", Address: "tess@example.com"}}, msgs[0].Personalizations[0].To)
+		require.Len(t, msgs[0].Content, 2)
+		require.Equal(t, "text/plain", msgs[0].Content[0].Type)
+		require.Contains(t, msgs[0].Content[0].Value, "Hello Tess Tester,")
+		require.Equal(t, "text/html", msgs[0].Content[1].Type)
+		require.Contains(t, msgs[0].Content[1].Value, "Hello Tess Tester,")
+	})
+
+	t.Run("DuplicateRecipients", func(t *testing.T) {
+		srv.Reset()
+		email, err := mailer.New("Tess Tester <tess@example.com>", "Duplicates", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		email.To = append(email.To, "tess@example.com")
+		email.CC = []string{"TESS@example.com", "ralph@example.com"}
+		email.BCC = []string{"Ralph <ralph@example.com>", "audit@example.com"}
+		require.NoError(t, email.Send(), "could not send email")
+		require.Equal(t, 1, srv.Requests())
+
+		msgs := srv.Messages()
+		require.Len(t, msgs, 1)
+		p := msgs[0].Personalizations[0]
+		require.Equal(t, []*sgmail.Email{{Name: "Tess Tester", Address: "tess@example.com"}}, p.To)
+		require.Equal(t, []*sgmail.Email{{Address: "ralph@example.com"}}, p.CC)
+		require.Equal(t, []*sgmail.Email{{Address: "audit@example.com"}}, p.BCC)
+	})
+
+	t.Run("BadRequest", func(t *testing.T) {
+		srv.Reset()
+		srv.Respond(commotest.BadRequest("from.email", "The from address does not match a verified Sender Identity."))
+
+		email, err := mailer.New("tess@example.com", "Rejected", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		err = email.Send()
+		var derr *commo.DeliveryError
+		require.ErrorAs(t, err, &derr, "expected a delivery error")
+		require.Equal(t, "sendgrid", derr.Backend)
+		require.Equal(t, http.StatusBadRequest, derr.StatusCode)
+		require.Contains(t, derr.Body, "The from address does not match a verified Sender Identity.")
+		require.False(t, derr.Retryable)
+		require.False(t, commo.Retryable(err))
+		require.Equal(t, 1, srv.Requests(), "expected bad requests not to be retried")
+		require.Empty(t, srv.Messages())
+	})
+
+	t.Run("RateLimited", func(t *testing.T) {
+		srv.Reset()
+		srv.Respond(commotest.RateLimited(0))
+
+		email, err := mailer.New("tess@example.com", "Rate Limited", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		require.NoError(t, email.Send(), "expected send to succeed after rate limit")
+		require.Equal(t, 2, srv.Requests())
+		require.Len(t, srv.Messages(), 1)
+	})
+
+	t.Run("RetryAfter", func(t *testing.T) {
+		srv.Reset()
+		srv.Respond(commotest.RateLimited(time.Second))
+
+		conf := conf
+		conf.Backoff.MaxElapsedTime = 5 * time.Second
+
+		mailer, err := commo.NewMailer(conf, loadTestTemplates())
+		require.NoError(t, err, "could not create sendgrid mailer")
+
+		email, err := mailer.New("tess@example.com", "Rate Limited", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		start := time.Now()
+		require.NoError(t, email.Send(), "expected send to succeed after rate limit")
+		require.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond, "expected send to wait for the retry after header")
+		require.Equal(t, 2, srv.Requests())
+
+		limit := mailer.Backend().(*commo.SendGridBackend).RateLimit()
+		require.Equal(t, 600, limit.Limit)
+		require.Zero(t, limit.Remaining)
+		require.False(t, limit.Reset.IsZero())
+	})
+
+	t.Run("RetryAfterExceedsElapsedTime", func(t *testing.T) {
+		srv.Reset()
+		srv.Respond(commotest.RateLimited(time.Minute))
+
+		email, err := mailer.New("tess@example.com", "Rate Limited", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		start := time.Now()
+		err = email.Send()
+		require.Less(t, time.Since(start), 100*time.Millisecond, "expected send to fail without waiting")
+
+		var derr *commo.DeliveryError
+		require.ErrorAs(t, err, &derr, "expected a delivery error")
+		require.Equal(t, http.StatusTooManyRequests, derr.StatusCode)
+		require.InDelta(t, time.Minute, derr.RetryAfter, float64(time.Second))
+		require.Equal(t, 1, srv.Requests())
+
+		limit := mailer.Backend().(*commo.SendGridBackend).RateLimit()
+		require.True(t, limit.Exceeded(), "expected the rate limit to be exceeded")
+	})
+
+	t.Run("ServerError", func(t *testing.T) {
+		srv.Reset()
+		srv.Respond(commotest.SendGridResponse{StatusCode: http.StatusServiceUnavailable})
+
+		email, err := mailer.New("tess@example.com", "Unavailable", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		err = email.Send()
+		var derr *commo.DeliveryError
+		require.ErrorAs(t, err, &derr, "expected a delivery error")
+		require.Equal(t, http.StatusServiceUnavailable, derr.StatusCode)
+		require.True(t, derr.Retryable)
+		require.Greater(t, srv.Requests(), 1, "expected send to be retried")
+		require.Empty(t, srv.Messages())
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		srv.Reset()
+		srv.Respond(commotest.SendGridResponse{StatusCode: http.StatusAccepted, Delay: time.Second, Times: 1})
+
+		email, err := mailer.New("tess@example.com", "Slow", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		require.NoError(t, email.Send(), "expected send to succeed after timeout")
+		require.Equal(t, 2, srv.Requests())
+		require.Len(t, srv.Messages(), 1)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		srv.Reset()
+		srv.Respond(commotest.SendGridResponse{StatusCode: http.StatusAccepted, Delay: time.Second})
+
+		email, err := mailer.New("tess@example.com", "Cancelled", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		require.ErrorIs(t, email.SendContext(ctx), context.DeadlineExceeded)
+		require.Less(t, time.Since(start), 100*time.Millisecond, "expected the request to be cancelled")
+		require.Equal(t, 1, srv.Requests())
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		srv.Reset()
+		conf := conf
+		conf.SendGrid.APIKey = "SG.wrong"
+
+		mailer, err := commo.NewMailer(conf, loadTestTemplates())
+		require.NoError(t, err, "could not create sendgrid mailer")
+
+		email, err := mailer.New("tess@example.com", "Unauthorized", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		err = email.Send()
+		require.ErrorContains(t, err, "authorization grant is invalid")
+
+		var derr *commo.DeliveryError
+		require.ErrorAs(t, err, &derr, "expected a delivery error")
+		require.Equal(t, http.StatusUnauthorized, derr.StatusCode)
+		require.False(t, derr.Retryable)
+		require.Equal(t, 1, srv.Requests(), "expected unauthorized requests not to be retried")
+		require.Empty(t, srv.Messages())
+	})
+}
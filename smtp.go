@@ -0,0 +1,67 @@
+package commo
+
+import (
+	"context"
+	"time"
+
+	"github.com/jordan-wright/email"
+)
+
+// SMTPBackend delivers emails using a pool of connections to an SMTP server.
+type SMTPBackend struct {
+	pool    *email.Pool
+	timeout time.Duration
+}
+
+var _ Backend = &SMTPBackend{}
+
+// NewSMTPBackend creates a connection pool to the SMTP server in the configuration.
+func NewSMTPBackend(conf Config) (_ *SMTPBackend, err error) {
+	backend := &SMTPBackend{
+		timeout: conf.Backoff.Timeout,
+	}
+
+	if backend.pool, err = conf.SMTP.Pool(); err != nil {
+		return nil, err
+	}
+	return backend, nil
+}
+
+// Send the message using a connection from the pool, waiting no longer than the
+// deadline of the context for a connection. The pool does not support contexts, so a
+// message that is already being transmitted to the server is not interrupted.
+func (b *SMTPBackend) Send(ctx context.Context, m *Message) (err error) {
+	var msg *email.Email
+	if msg, err = m.ToSMTP(); err != nil {
+		return Permanent(err)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	timeout := b.timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < timeout {
+			if remaining <= 0 {
+				return context.DeadlineExceeded
+			}
+			timeout = remaining
+		}
+	}
+
+	if err = b.pool.Send(msg, timeout); err != nil {
+		return newSMTPError(err)
+	}
+	return nil
+}
+
+func (b *SMTPBackend) Name() string {
+	return "smtp"
+}
+
+// Close the connection pool, waiting for connections that are in use to be returned.
+func (b *SMTPBackend) Close() error {
+	b.pool.Close()
+	return nil
+}
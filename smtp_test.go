@@ -0,0 +1,190 @@
+package commo_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jordan-wright/email"
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+	"go.rtnl.ai/commo/commotest"
+)
+
+func TestSMTPPool(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cramMD5  bool
+		startTLS bool
+	}{
+		{"Plain", false, false},
+		{"CRAMMD5", true, false},
+		{"STARTTLS", false, true},
+		{"STARTTLSCRAMMD5", true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := commotest.NewUnstartedSMTPServer()
+			srv.Username = "jszack"
+			srv.Password = "supersecret"
+			if tc.startTLS {
+				srv.StartTLS()
+			} else {
+				srv.Start()
+			}
+			t.Cleanup(srv.Close)
+
+			conf := srv.Config()
+			conf.UseCRAMMD5 = tc.cramMD5
+			require.NoError(t, conf.Validate(), "expected valid smtp config")
+
+			pool, err := conf.Pool()
+			require.NoError(t, err, "could not create smtp pool")
+			defer pool.Close()
+
+			msg := email.NewEmail()
+			msg.From = "Jane Szack <jane@example.com>"
+			msg.To = []string{"test@example.com"}
+			msg.Subject = "Pool Test"
+			msg.Text = []byte("Hello from the pool")
+
+			err = pool.Send(msg, 5*time.Second)
+			require.NoError(t, err, "could not send email via pool")
+
+			msgs := srv.Messages()
+			require.Len(t, msgs, 1)
+			require.Equal(t, "jane@example.com", msgs[0].From)
+			require.Equal(t, []string{"test@example.com"}, msgs[0].Recipients)
+			require.Equal(t, "Pool Test", msgs[0].Subject)
+			require.Equal(t, "Hello from the pool", strings.TrimSpace(msgs[0].Text))
+		})
+	}
+}
+
+func TestSMTPSend(t *testing.T) {
+	srv := commotest.NewUnstartedSMTPServer()
+	srv.Username = "jszack"
+	srv.Password = "supersecret"
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	conf := commo.Config{
+		Sender:  "Jane Szack <jane@example.com>",
+		SMTP:    srv.Config(),
+		Backoff: fastBackoff(),
+	}
+
+	mailer, err := commo.NewMailer(conf, loadTestTemplates())
+	require.NoError(t, err, "could not create smtp mailer")
+	require.Equal(t, "smtp", mailer.Backend().Name())
+	t.Cleanup(func() { mailer.Close() })
+
+	t.Run("Send", func(t *testing.T) {
+		srv.Reset()
+		data := struct{ ContactName string }{ContactName: "Tess Tester"}
+		email, err := mailer.New("Tess Tester <tess@example.com>", "Test Subject", "test_email", data)
+		require.NoError(t, err, "could not create email")
+		require.NoError(t, email.Send(), "could not send email")
+
+		msgs := srv.Messages()
+		require.Len(t, msgs, 1)
+		require.Equal(t, "jane@example.com", msgs[0].From)
+		require.Equal(t, []string{"tess@example.com"}, msgs[0].Recipients)
+		require.Equal(t, "Test Subject", msgs[0].Subject)
+		require.Equal(t, `"Jane Szack" <jane@example.com>`, msgs[0].Header.Get("From"))
+		require.Contains(t, msgs[0].Text, "Hello Tess Tester,")
+		require.Contains(t, msgs[0].HTML, "Hello Tess Tester,")
+	})
+
+	t.Run("CCAndBCC", func(t *testing.T) {
+		srv.Reset()
+		email, err := mailer.New("tess@example.com", "Copied", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		email.CC = []string{"owner@example.com"}
+		email.BCC = []string{"audit@example.com"}
+		email.ReplyTo = "support@example.com"
+		require.NoError(t, email.Send(), "could not send email")
+
+		msgs := srv.Messages()
+		require.Len(t, msgs, 1)
+		require.Equal(t, []string{"tess@example.com", "owner@example.com", "audit@example.com"}, msgs[0].Recipients)
+		require.Equal(t, "<owner@example.com>", msgs[0].Header.Get("Cc"))
+		require.Equal(t, "support@example.com", msgs[0].Header.Get("Reply-To"))
+		require.Empty(t, msgs[0].Header.Get("Bcc"))
+		require.NotContains(t, string(msgs[0].Raw), "audit@example.com", "bcc address leaked into the message")
+	})
+
+	t.Run("TransientFailure", func(t *testing.T) {
+		srv.Reset()
+		srv.SetReply("MAIL", commotest.Reply{Code: 421, Message: "4.3.2 Service not available", Times: 2})
+
+		email, err := mailer.New("tess@example.com", "Retried", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		require.NoError(t, email.Send(), "expected email to be sent after retries")
+		require.Len(t, srv.Messages(), 1)
+	})
+
+	t.Run("PermanentFailure", func(t *testing.T) {
+		srv.Reset()
+		srv.SetReply("RCPT", commotest.Reply{Code: 550, Message: "5.1.1 Mailbox does not exist"})
+
+		email, err := mailer.New("nobody@example.com", "Rejected", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		err = email.Send()
+		require.ErrorContains(t, err, "5.1.1 Mailbox does not exist")
+
+		var derr *commo.DeliveryError
+		require.ErrorAs(t, err, &derr, "expected a delivery error")
+		require.Equal(t, "smtp", derr.Backend)
+		require.Equal(t, 550, derr.StatusCode)
+		require.Equal(t, "5.1.1", derr.EnhancedCode)
+		require.False(t, derr.Retryable)
+		require.True(t, derr.BadRecipient())
+		require.Empty(t, srv.Messages())
+	})
+
+	t.Run("MessageRejected", func(t *testing.T) {
+		srv.Reset()
+		srv.SetReply(commotest.ReplyMessage, commotest.Reply{Code: 554, Message: "5.7.1 Message rejected as spam"})
+
+		email, err := mailer.New("tess@example.com", "Spam", "test_email", nil)
+		require.NoError(t, err, "could not create email")
+		err = email.Send()
+		require.ErrorContains(t, err, "5.7.1 Message rejected as spam")
+
+		var derr *commo.DeliveryError
+		require.ErrorAs(t, err, &derr, "expected a delivery error")
+		require.Equal(t, 554, derr.StatusCode)
+		require.Equal(t, "5.7.1", derr.EnhancedCode)
+		require.False(t, derr.BadRecipient())
+		require.False(t, commo.Retryable(err))
+		require.Empty(t, srv.Messages())
+	})
+}
+
+func TestSMTPAuthFailure(t *testing.T) {
+	srv := commotest.NewUnstartedSMTPServer()
+	srv.Username = "jszack"
+	srv.Password = "supersecret"
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	conf := commo.Config{
+		Sender:  "Jane Szack <jane@example.com>",
+		SMTP:    srv.Config(),
+		Backoff: fastBackoff(),
+	}
+	conf.Backoff.Timeout = 100 * time.Millisecond
+	conf.Backoff.MaxElapsedTime = 200 * time.Millisecond
+	conf.SMTP.Password = "wrongpassword"
+
+	// NOTE: the mailer is not closed since the pool may still be building connections.
+	mailer, err := commo.NewMailer(conf, loadTestTemplates())
+	require.NoError(t, err, "could not create smtp mailer")
+
+	email, err := mailer.New("tess@example.com", "Unauthorized", "test_email", nil)
+	require.NoError(t, err, "could not create email")
+	require.ErrorContains(t, email.Send(), "Authentication credentials invalid")
+	require.Empty(t, srv.Messages())
+}
@@ -0,0 +1,396 @@
+package commo
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template file extensions; every email template is a pair of a text and an html
+// template with the same base name, e.g. welcome.txt and welcome.html.
+const (
+	TextExt = ".txt"
+	HTMLExt = ".html"
+)
+
+// Templates are the email templates used to render emails, keyed by the name of the
+// template without its extension. The plain text bodies are rendered with text/template
+// so that the data is not html escaped; the html bodies are rendered with html/template.
+type Templates struct {
+	Text map[string]*texttemplate.Template
+	HTML map[string]*template.Template
+
+	// If true, the text body of an email whose template does not have a text template
+	// is generated from the rendered html with HTMLToText.
+	GenerateText bool
+
+	// If true, the style blocks of the rendered html are inlined into the style
+	// attributes of the elements that they match with InlineCSS.
+	InlineCSS bool
+
+	// The templates parsed with the translation and formatting functions of each
+	// supported locale and the message catalogs that back them.
+	localized map[string]*Templates
+	catalogs  *catalogs
+
+	// Reloads the templates when they change on the file system; see WatchTemplates.
+	watcher *watcher
+}
+
+// Names returns the sorted names of the email templates that can be rendered, e.g.
+// that have both a text and an html template (or only an html template if the text
+// is generated). Localized variants such as welcome.fr are listed by their name.
+func (t *Templates) Names() []string {
+	t = t.current()
+	seen := make(map[string]struct{}, len(t.HTML))
+	for name := range t.HTML {
+		if _, ok := t.Text[name]; ok || t.GenerateText {
+			base, _ := t.splitLocale(name)
+			seen[base] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Locales returns the sorted locales that the templates were parsed for; the locales
+// of the message catalogs, of localized templates, and of the layout.
+func (t *Templates) Locales() []string {
+	t = t.current()
+	locales := make([]string, 0, len(t.localized))
+	for locale := range t.localized {
+		locales = append(locales, locale)
+	}
+
+	sort.Strings(locales)
+	return locales
+}
+
+// Option sets options on every text and html template, including the localized
+// templates, e.g. "missingkey=error". See text/template's Template.Option for the
+// supported options. The templates are returned so that calls can be chained. If the
+// templates are watched, the templates are reloaded with the options rather than
+// modified, and the options are also set on the templates that are reloaded later.
+func (t *Templates) Option(opt ...string) *Templates {
+	if t.watcher != nil {
+		t.watcher.option(opt)
+		return t
+	}
+	return t.setOption(opt...)
+}
+
+func (t *Templates) setOption(opt ...string) *Templates {
+	for _, tt := range t.Text {
+		tt.Option(opt...)
+	}
+
+	for _, ht := range t.HTML {
+		ht.Option(opt...)
+	}
+
+	for _, localized := range t.localized {
+		localized.setOption(opt...)
+	}
+	return t
+}
+
+// Returns the templates parsed for the locale and the name of the most specific
+// localized variant of the template, e.g. welcome.fr-CA, then welcome.fr, and finally
+// welcome. If the locale is not supported the default templates are returned.
+func (t *Templates) resolve(name, locale string) (*Templates, string) {
+	t = t.current()
+	chain := localeChain(locale)
+
+	set := t
+	for _, tag := range chain {
+		if localized, ok := t.localized[tag]; ok {
+			set = localized
+			break
+		}
+	}
+
+	for _, tag := range chain {
+		if _, ok := t.localized[tag]; !ok {
+			continue
+		}
+
+		if _, ok := set.HTML[name+"."+tag]; ok {
+			return set, name + "." + tag
+		}
+	}
+	return set, name
+}
+
+// Splits a template name into its name and locale using the supported locales of the
+// templates; see splitLocale.
+func (t *Templates) splitLocale(name string) (string, string) {
+	return splitLocale(name, func(locale string) bool {
+		_, ok := t.localized[locale]
+		return ok
+	})
+}
+
+// Splits a template name into its name and locale, e.g. welcome.fr-CA into welcome
+// and fr-CA; the locale is empty if the template is not localized. Only the supported
+// locales are split off so that dotted names such as invite.new or report.old are not
+// mistaken for localized templates.
+func splitLocale(name string, supported func(string) bool) (string, string) {
+	if i := strings.LastIndexByte(name, '.'); i > 0 && isLocale(name[i+1:]) {
+		if locale := NormalizeLocale(name[i+1:]); supported(locale) {
+			return name[:i], locale
+		}
+	}
+	return name, ""
+}
+
+// Layout describes how the email templates are arranged in a file system.
+type Layout struct {
+	// The directory that contains the email templates; defaults to the root of the
+	// file system. Files in the directory without a template extension are ignored.
+	Dir string
+
+	// The directory relative to Dir that contains the partials (e.g. base layouts and
+	// shared blocks) that are parsed with every template that has the same extension;
+	// defaults to "partials". Partials are parsed before the template so that the
+	// template can override the blocks that they define.
+	Partials string
+
+	// Additional functions to add to the templates along with the commo FuncMap.
+	Funcs template.FuncMap
+
+	// If true, html templates do not require a text counterpart; the text body is
+	// generated from the rendered html instead. See Templates.GenerateText.
+	GenerateText bool
+
+	// If true, the css of the rendered html is inlined. See Templates.InlineCSS.
+	InlineCSS bool
+
+	// The directory relative to Dir that contains the message catalogs named by their
+	// locale, e.g. fr.json or fr-CA.po; defaults to "locales".
+	Catalogs string
+
+	// Additional locales to support, e.g. for localized templates (welcome.fr-CA.html)
+	// or the date, number, and currency formatting functions; the locales of the
+	// catalogs are always supported. A template is only localized if its locale is
+	// supported, otherwise the dotted suffix is part of its name (e.g. invite.new).
+	Locales []string
+
+	// The declared data types of the templates by name, e.g. {"welcome": Welcome{}}.
+	// If set, the templates are checked against the types when they are loaded and a
+	// *SchemaError is returned if any reference cannot be resolved. See Templates.Check.
+	Schemas map[string]any
+}
+
+// DefaultLayout expects the templates at the root of the file system, the partials in
+// the partials directory, and the message catalogs in the locales directory.
+var DefaultLayout = Layout{Dir: ".", Partials: "partials", Catalogs: "locales"}
+
+// LoadTemplates parses the email templates in the file system (e.g. an embed.FS or an
+// os.DirFS) that are arranged by the layout, returning templates that can be passed to
+// Initialize or NewMailer. The .txt files are parsed as text templates and the .html
+// files as html templates. An error is returned if any template is missing its text
+// or html counterpart, unless the layout generates text from the html. Localized
+// templates are named with their locale before the extension, e.g. welcome.fr.html;
+// the locale must have a catalog or be listed in the Locales of the layout.
+func LoadTemplates(fsys fs.FS, layout Layout) (_ *Templates, err error) {
+	if layout.Dir == "" {
+		layout.Dir = DefaultLayout.Dir
+	}
+
+	if layout.Partials == "" {
+		layout.Partials = DefaultLayout.Partials
+	}
+
+	if layout.Catalogs == "" {
+		layout.Catalogs = DefaultLayout.Catalogs
+	}
+
+	var entries []fs.DirEntry
+	if entries, err = fs.ReadDir(fsys, layout.Dir); err != nil {
+		return nil, fmt.Errorf("could not read templates directory: %w", err)
+	}
+
+	// Collect the names of the templates by extension to check that they are paired.
+	names := make(map[string]map[string]bool, 2)
+	names[TextExt] = make(map[string]bool)
+	names[HTMLExt] = make(map[string]bool)
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		ext := path.Ext(entry.Name())
+		if _, ok := names[ext]; ok {
+			names[ext][strings.TrimSuffix(entry.Name(), ext)] = true
+		}
+	}
+
+	if err = checkPairs(names, layout.GenerateText); err != nil {
+		return nil, err
+	}
+
+	var cats *catalogs
+	if cats, err = loadCatalogs(fsys, path.Join(layout.Dir, layout.Catalogs)); err != nil {
+		return nil, err
+	}
+
+	// The locales of the catalogs and of the layout are supported.
+	locales := make(map[string]struct{})
+	for _, locale := range append(cats.tags(), layout.Locales...) {
+		locales[NormalizeLocale(locale)] = struct{}{}
+	}
+	delete(locales, "")
+
+	var templates *Templates
+	if templates, err = parseTemplates(fsys, layout, names, "", locales, cats); err != nil {
+		return nil, err
+	}
+
+	templates.GenerateText = layout.GenerateText
+	templates.InlineCSS = layout.InlineCSS
+	templates.catalogs = cats
+
+	// Each supported locale has its own templates so that the translation and
+	// formatting functions are bound to the locale.
+	templates.localized = make(map[string]*Templates, len(locales))
+	for locale := range locales {
+		if templates.localized[locale], err = parseTemplates(fsys, layout, names, locale, locales, cats); err != nil {
+			return nil, err
+		}
+	}
+
+	if layout.Schemas != nil {
+		if err = templates.Check(layout.Schemas); err != nil {
+			return nil, err
+		}
+	}
+
+	return templates, nil
+}
+
+// Parse the templates with the functions of the locale. Localized templates are only
+// parsed for the locales that they could be resolved for.
+func parseTemplates(fsys fs.FS, layout Layout, names map[string]map[string]bool, locale string, locales map[string]struct{}, cats *catalogs) (_ *Templates, err error) {
+	funcs := FuncMap()
+	for name, fn := range localeFuncs(locale, cats) {
+		funcs[name] = fn
+	}
+
+	for name, fn := range layout.Funcs {
+		funcs[name] = fn
+	}
+
+	// Functions that render html are replaced in the text templates unless they are
+	// overridden by the layout.
+	textFuncs := textFuncs()
+	for name := range layout.Funcs {
+		delete(textFuncs, name)
+	}
+
+	chain := localeChain(locale)
+	supported := func(tag string) bool {
+		_, ok := locales[tag]
+		return ok
+	}
+
+	include := func(base string) bool {
+		_, tag := splitLocale(base, supported)
+		return tag == "" || containsString(chain, tag)
+	}
+
+	// Each template is parsed independently to ensure that define directives are not
+	// overridden by other templates that define blocks with the same name.
+	templates := &Templates{
+		Text: make(map[string]*texttemplate.Template, len(names[TextExt])),
+		HTML: make(map[string]*template.Template, len(names[HTMLExt])),
+	}
+
+	var partials []string
+	if partials, err = globPartials(fsys, layout, TextExt); err != nil {
+		return nil, err
+	}
+
+	for base := range names[TextExt] {
+		if !include(base) {
+			continue
+		}
+
+		name := base + TextExt
+		patterns := append(partials[:len(partials):len(partials)], path.Join(layout.Dir, name))
+		if templates.Text[base], err = texttemplate.New(name).Funcs(texttemplate.FuncMap(funcs)).Funcs(texttemplate.FuncMap(textFuncs)).ParseFS(fsys, patterns...); err != nil {
+			return nil, fmt.Errorf("could not parse template %q: %w", name, err)
+		}
+	}
+
+	if partials, err = globPartials(fsys, layout, HTMLExt); err != nil {
+		return nil, err
+	}
+
+	for base := range names[HTMLExt] {
+		if !include(base) {
+			continue
+		}
+
+		name := base + HTMLExt
+		patterns := append(partials[:len(partials):len(partials)], path.Join(layout.Dir, name))
+		if templates.HTML[base], err = template.New(name).Funcs(funcs).ParseFS(fsys, patterns...); err != nil {
+			return nil, fmt.Errorf("could not parse template %q: %w", name, err)
+		}
+	}
+
+	return templates, nil
+}
+
+// MustLoadTemplates is like LoadTemplates but panics if the templates cannot be loaded.
+func MustLoadTemplates(fsys fs.FS, layout Layout) *Templates {
+	templates, err := LoadTemplates(fsys, layout)
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// Returns the paths of the partials with the specified extension.
+func globPartials(fsys fs.FS, layout Layout, ext string) ([]string, error) {
+	return fs.Glob(fsys, path.Join(layout.Dir, layout.Partials, "*"+ext))
+}
+
+// Returns an error for every template that is missing its text or html counterpart;
+// html templates may be missing their text counterpart if the text is generated.
+func checkPairs(names map[string]map[string]bool, generateText bool) error {
+	var missing []string
+	for base := range names[TextExt] {
+		if !names[HTMLExt][base] {
+			missing = append(missing, fmt.Sprintf("template %q is missing %q", base+TextExt, base+HTMLExt))
+		}
+	}
+
+	for base := range names[HTMLExt] {
+		if !names[TextExt][base] && !generateText {
+			missing = append(missing, fmt.Sprintf("template %q is missing %q", base+HTMLExt, base+TextExt))
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	sort.Strings(missing)
+	errs := make([]error, 0, len(missing))
+	for _, msg := range missing {
+		errs = append(errs, fmt.Errorf("%s: %w", msg, ErrMissingCounterpart))
+	}
+	return errors.Join(errs...)
+}
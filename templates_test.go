@@ -0,0 +1,88 @@
+package commo_test
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	t.Run("TestData", func(t *testing.T) {
+		templates, err := commo.LoadTemplates(files, commo.Layout{Dir: "testdata/templates"})
+		require.NoError(t, err, "could not load test templates")
+		require.Equal(t, []string{"inline_image", "invoice", "test_email"}, templates.Names())
+	})
+
+	t.Run("DefaultLayout", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"welcome.txt":           {Data: []byte(`{{ template "signature" }}Welcome {{ .Name }}!`)},
+			"welcome.html":          {Data: []byte(`{{ template "base" . }}{{ define "content" }}<p>Welcome {{ .Name }}!</p>{{ end }}`)},
+			"README.md":             {Data: []byte("ignored")},
+			"partials/base.html":    {Data: []byte(`{{ define "base" }}<html>{{ block "content" . }}default{{ end }}</html>{{ end }}`)},
+			"partials/sign.txt":     {Data: []byte(`{{ define "signature" }}-- {{ shout "hi" }}{{ end }}`)},
+			"partials/ignored.html": {Data: []byte(`{{ define "other" }}{{ end }}`)},
+		}
+
+		layout := commo.DefaultLayout
+		layout.Funcs = template.FuncMap{"shout": strings.ToUpper}
+
+		templates, err := commo.LoadTemplates(fsys, layout)
+		require.NoError(t, err, "could not load templates")
+		require.Equal(t, []string{"welcome"}, templates.Names())
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, templates.HTML["welcome"].Execute(buf, map[string]string{"Name": "Tess"}))
+		require.Equal(t, "<html><p>Welcome Tess!</p></html>", buf.String(), "expected template to override the partial block")
+
+		buf.Reset()
+		require.NoError(t, templates.Text["welcome"].Execute(buf, map[string]string{"Name": "Tess"}))
+		require.Equal(t, "-- HIWelcome Tess!", buf.String(), "expected text partials and custom funcs")
+	})
+
+	t.Run("NoPartials", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"emails/welcome.txt":  {Data: []byte(`Welcome!`)},
+			"emails/welcome.html": {Data: []byte(`<img src="{{ cid "logo.png" }}" />`)},
+		}
+
+		templates, err := commo.LoadTemplates(fsys, commo.Layout{Dir: "emails"})
+		require.NoError(t, err, "could not load templates")
+		require.Equal(t, []string{"welcome"}, templates.Names())
+	})
+
+	t.Run("MissingCounterpart", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"welcome.txt":  {Data: []byte(`Welcome!`)},
+			"welcome.html": {Data: []byte(`<p>Welcome!</p>`)},
+			"reset.txt":    {Data: []byte(`Reset your password`)},
+			"invite.html":  {Data: []byte(`<p>You're invited!</p>`)},
+		}
+
+		_, err := commo.LoadTemplates(fsys, commo.DefaultLayout)
+		require.ErrorIs(t, err, commo.ErrMissingCounterpart)
+		require.ErrorContains(t, err, `template "invite.html" is missing "invite.txt"`)
+		require.ErrorContains(t, err, `template "reset.txt" is missing "reset.html"`)
+	})
+
+	t.Run("ParseError", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"welcome.txt":  {Data: []byte(`Welcome!`)},
+			"welcome.html": {Data: []byte(`<p>Welcome {{ .Name }</p>`)},
+		}
+
+		_, err := commo.LoadTemplates(fsys, commo.DefaultLayout)
+		require.ErrorContains(t, err, `could not parse template "welcome.html"`)
+	})
+
+	t.Run("MissingDir", func(t *testing.T) {
+		_, err := commo.LoadTemplates(fstest.MapFS{}, commo.Layout{Dir: "templates"})
+		require.ErrorContains(t, err, "could not read templates directory")
+
+		require.Panics(t, func() { commo.MustLoadTemplates(fstest.MapFS{}, commo.Layout{Dir: "templates"}) })
+	})
+}
@@ -0,0 +1,342 @@
+package commo
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToText generates a readable plain text version of a rendered html email. Headings,
+// paragraphs, lists, and tables are converted to text blocks, links are written as
+// "text [url]", and content that is hidden from readers such as preheaders and spacers,
+// images, styles, and comments (including MSO conditional comments) are dropped.
+func HTMLToText(src []byte) (_ []byte, err error) {
+	var doc *html.Node
+	if doc, err = html.Parse(bytes.NewReader(src)); err != nil {
+		return nil, err
+	}
+
+	w := &textWriter{lineStart: true}
+	w.walk(doc)
+
+	text := strings.TrimSpace(w.buf.String())
+	if text == "" {
+		return []byte{}, nil
+	}
+	return []byte(text + "\n"), nil
+}
+
+// Zero width characters that are used by spacers and to break auto linking.
+var zeroWidth = strings.NewReplacer("\u200b", "", "\u200c", "", "\u200d", "", "\u034f", "", "\ufeff", "")
+
+// Writes text blocks, collapsing whitespace the way that a browser would.
+type textWriter struct {
+	buf       strings.Builder
+	indent    string // prefix for every line, e.g. for nested list items
+	lineStart bool   // nothing has been written to the current line yet
+	newlines  int    // the number of newlines at the end of the buffer
+	space     bool   // a space is pending before the next word
+}
+
+func (w *textWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.DocumentNode:
+		w.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if hidden(n) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Style, atom.Script, atom.Title, atom.Img:
+		return
+	case atom.Br:
+		w.lineBreak()
+	case atom.Hr:
+		w.block(2)
+		w.word("----------")
+		w.block(2)
+	case atom.H1, atom.H2:
+		line := "="
+		if n.DataAtom == atom.H2 {
+			line = "-"
+		}
+
+		heading := inline(n)
+		w.block(2)
+		w.word(heading)
+		w.block(1)
+		w.word(strings.Repeat(line, len([]rune(heading))))
+		w.block(2)
+	case atom.H3, atom.H4, atom.H5, atom.H6, atom.P, atom.Blockquote, atom.Pre:
+		w.block(2)
+		w.children(n)
+		w.block(2)
+	case atom.Ul, atom.Ol:
+		// Nested lists are not separated from their parent item by a blank line.
+		sep := 2
+		if w.indent != "" {
+			sep = 1
+		}
+
+		w.block(sep)
+		w.list(n)
+		w.block(sep)
+	case atom.Table:
+		w.block(1)
+		if isDataTable(n) {
+			w.table(n)
+		} else {
+			w.children(n)
+		}
+		w.block(1)
+	case atom.A:
+		w.link(n)
+	case atom.Div, atom.Center, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main,
+		atom.Tr, atom.Td, atom.Th, atom.Li, atom.Dl, atom.Dt, atom.Dd, atom.Address, atom.Figure, atom.Figcaption:
+		w.block(1)
+		w.children(n)
+		w.block(1)
+	default:
+		w.children(n)
+	}
+}
+
+func (w *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+}
+
+// Write the list items prefixed by a bullet or their number.
+func (w *textWriter) list(n *html.Node) {
+	num := 1
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Li || hidden(c) {
+			continue
+		}
+
+		marker := "* "
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(num) + ". "
+			num++
+		}
+
+		w.block(1)
+		w.word(marker)
+		w.space = false
+
+		indent := w.indent
+		w.indent += strings.Repeat(" ", len(marker))
+		w.children(c)
+		w.indent = indent
+		w.block(1)
+	}
+}
+
+// Write each row of a data table on its own line with the cells separated by pipes.
+func (w *textWriter) table(n *html.Node) {
+	for _, row := range rows(n) {
+		cells := make([]string, 0, 4)
+		for c := row.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && (c.DataAtom == atom.Td || c.DataAtom == atom.Th) && !hidden(c) {
+				cells = append(cells, inline(c))
+			}
+		}
+
+		w.block(1)
+		w.word(strings.Join(cells, " | "))
+		w.block(1)
+	}
+}
+
+// Write the link text followed by the url unless the text is the url.
+func (w *textWriter) link(n *html.Node) {
+	text := inline(n)
+	href := strings.TrimSpace(attr(n, "href"))
+	switch {
+	case href == "" || strings.HasPrefix(href, "#"):
+		w.text(text)
+	case text == "":
+		w.text(href)
+	case text == href || "mailto:"+text == href || "tel:"+text == href:
+		w.text(text)
+	default:
+		w.text(text)
+		w.space = true
+		w.word("[" + href + "]")
+	}
+}
+
+func (w *textWriter) text(s string) {
+	s = zeroWidth.Replace(s)
+	if s == "" {
+		return
+	}
+
+	if unicode.IsSpace([]rune(s)[0]) {
+		w.space = true
+	}
+
+	words := strings.Fields(s)
+	for i, word := range words {
+		if i > 0 {
+			w.space = true
+		}
+		w.word(word)
+	}
+
+	if len(words) > 0 && strings.TrimRightFunc(s, unicode.IsSpace) != s {
+		w.space = true
+	}
+}
+
+func (w *textWriter) word(s string) {
+	if s == "" {
+		return
+	}
+
+	switch {
+	case w.lineStart:
+		w.buf.WriteString(w.indent)
+	case w.space:
+		w.buf.WriteByte(' ')
+	}
+
+	w.buf.WriteString(s)
+	w.lineStart, w.newlines, w.space = false, 0, false
+}
+
+func (w *textWriter) lineBreak() {
+	w.buf.WriteByte('\n')
+	w.lineStart, w.space = true, false
+	w.newlines++
+}
+
+// Ensure the next word starts a new block that is separated by n newlines.
+func (w *textWriter) block(n int) {
+	w.space = false
+	if w.buf.Len() == 0 {
+		return
+	}
+
+	for w.newlines < n {
+		w.lineBreak()
+	}
+}
+
+// Returns the text of the node collapsed onto a single line.
+func inline(n *html.Node) string {
+	sub := &textWriter{lineStart: true}
+	sub.children(n)
+	return strings.Join(strings.Fields(sub.buf.String()), " ")
+}
+
+// Returns true if the element is hidden from readers, e.g. the preheader and spacer
+// blocks of an email template.
+func hidden(n *html.Node) bool {
+	if attr(n, "aria-hidden") == "true" || hasAttr(n, "hidden") {
+		return true
+	}
+
+	style := strings.ToLower(strings.Join(strings.Fields(attr(n, "style")), ""))
+	if style == "" {
+		return false
+	}
+
+	for _, rule := range strings.Split(style, ";") {
+		switch rule {
+		case "display:none", "visibility:hidden", "max-height:0", "max-height:0px", "opacity:0":
+			return true
+		}
+	}
+	return false
+}
+
+// Tables that are marked as presentation or that contain other tables are used for
+// layout; all other tables with more than one column are treated as data tables.
+func isDataTable(n *html.Node) bool {
+	if attr(n, "role") == "presentation" {
+		return false
+	}
+
+	columns := 0
+	for _, row := range rows(n) {
+		cells := 0
+		for c := row.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+
+			if c.DataAtom == atom.Td || c.DataAtom == atom.Th {
+				if contains(c, atom.Table) {
+					return false
+				}
+				cells++
+			}
+		}
+		columns = max(columns, cells)
+	}
+	return columns > 1
+}
+
+// Returns the rows of the table, excluding the rows of nested tables.
+func rows(table *html.Node) (out []*html.Node) {
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+
+			switch c.DataAtom {
+			case atom.Tr:
+				out = append(out, c)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				find(c)
+			}
+		}
+	}
+
+	find(table)
+	return out
+}
+
+func contains(n *html.Node, a atom.Atom) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if (c.Type == html.ElementNode && c.DataAtom == a) || contains(c, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
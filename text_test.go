@@ -0,0 +1,68 @@
+package commo_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+func TestHTMLToText(t *testing.T) {
+	testCases := []struct {
+		html     string
+		expected string
+	}{
+		{"", ""},
+		{"<p>Hello   <b>Tess</b>,\n  welcome!</p>", "Hello Tess, welcome!\n"},
+		{"<p>First</p><p>Second<br>line</p>", "First\n\nSecond\nline\n"},
+		{"<h1>Welcome</h1><h2>Getting Started</h2><h3>Step 1</h3><p>Sign in</p>", "Welcome\n=======\n\nGetting Started\n---------------\n\nStep 1\n\nSign in\n"},
+		{"<ul><li>One</li><li>Two<ol><li>A</li><li>B</li></ol></li></ul>", "* One\n* Two\n  1. A\n  2. B\n"},
+		{`<p>Please <a href="https://example.com/verify">verify your email</a>.</p>`, "Please verify your email [https://example.com/verify].\n"},
+		{`<a href="https://example.com">https://example.com</a> <a href="mailto:help@example.com">help@example.com</a>`, "https://example.com help@example.com\n"},
+		{`<a href="#top">Top</a> <a href="https://example.com"><img src="logo.png" alt="Logo" /></a>`, "Top https://example.com\n"},
+		{"<table><tr><th>Item</th><th>Price</th></tr><tr><td>Widget</td><td>$4.00</td></tr></table>", "Item | Price\nWidget | $4.00\n"},
+		{`<table role="presentation"><tr><td>Left</td><td>Right</td></tr></table>`, "Left\nRight\n"},
+		{`<table><tr><td><table><tr><td>Nested</td></tr></table></td><td>Layout</td></tr></table>`, "Nested\nLayout\n"},
+		{`<div style="display: none">hidden</div><div style="max-height: 0; overflow: hidden;" aria-hidden="true">preheader</div><p>Visible</p>`, "Visible\n"},
+		{"<html><head><title>Title</title><style>p { color: red; }</style></head><body><!--[if mso]><p>Outlook</p><![endif]--><p>Body&nbsp;text&zwnj;</p></body></html>", "Body text\n"},
+		{"<p>Above</p><hr><p>Below</p>", "Above\n\n----------\n\nBelow\n"},
+	}
+
+	for i, tc := range testCases {
+		text, err := commo.HTMLToText([]byte(tc.html))
+		require.NoError(t, err, "test case %d errored", i)
+		require.Equal(t, tc.expected, string(text), "test case %d failed", i)
+	}
+}
+
+func TestGenerateText(t *testing.T) {
+	fsys := fstest.MapFS{
+		"welcome.html":       {Data: []byte(`{{ template "base" . }}{{ define "content" }}<p>Welcome {{ .Name }}!</p><p><a href="{{ .URL }}">Get started</a></p>{{ end }}`)},
+		"reset.txt":          {Data: []byte(`Reset your password, {{ .Name }}`)},
+		"reset.html":         {Data: []byte(`<p>Reset your password, {{ .Name }}</p>`)},
+		"partials/base.html": {Data: []byte(`{{ define "base" }}<html><body><div style="display:none">Preheader</div>{{ block "content" . }}{{ end }}</body></html>{{ end }}`)},
+	}
+
+	_, err := commo.LoadTemplates(fsys, commo.DefaultLayout)
+	require.ErrorIs(t, err, commo.ErrMissingCounterpart, "expected missing text template without generate text")
+
+	layout := commo.DefaultLayout
+	layout.GenerateText = true
+	templates, err := commo.LoadTemplates(fsys, layout)
+	require.NoError(t, err, "could not load templates")
+	require.Equal(t, []string{"reset", "welcome"}, templates.Names())
+
+	mailer, err := commo.NewMailer(commo.Config{}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	data := map[string]string{"Name": "Tess O'Brien", "URL": "https://example.com/start"}
+	text, _, err := mailer.RenderString("welcome", data)
+	require.NoError(t, err, "could not render welcome")
+	require.Equal(t, "Welcome Tess O'Brien!\n\nGet started [https://example.com/start]\n", text)
+
+	// Text templates are still used if they exist.
+	text, _, err = mailer.RenderString("reset", data)
+	require.NoError(t, err, "could not render reset")
+	require.Equal(t, "Reset your password, Tess O'Brien", text)
+}
@@ -0,0 +1,220 @@
+package commo
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultWatchInterval is the interval that the file system is polled at by
+// WatchTemplates if the interval is not specified.
+const DefaultWatchInterval = time.Second
+
+// WatchTemplates loads the templates like LoadTemplates and then polls the file system
+// for changes to the templates, partials, and message catalogs in the directory of the
+// layout, reloading all of the templates when any file changes. This is intended for
+// development so that templates can be edited without restarting the service; because
+// the file system is polled, the modification times of its files must change (e.g.
+// os.DirFS rather than embed.FS).
+//
+// The returned templates can be passed to Initialize or NewMailer as usual and always
+// render with the latest set that was loaded successfully; the new set replaces the
+// old one atomically and emails that are being sent keep the set they started with.
+// If the templates cannot be reloaded the last good set is kept and the error is
+// reported to the OnError function; see LastError. Call Close to stop watching the
+// file system.
+func WatchTemplates(fsys fs.FS, layout Layout, interval time.Duration) (_ *Templates, err error) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	if layout.Dir == "" {
+		layout.Dir = DefaultLayout.Dir
+	}
+
+	w := &watcher{fsys: fsys, layout: layout, done: make(chan struct{})}
+	if w.fingerprint, err = fingerprint(fsys, layout.Dir); err != nil {
+		return nil, fmt.Errorf("could not read templates directory: %w", err)
+	}
+
+	var templates *Templates
+	if templates, err = LoadTemplates(fsys, layout); err != nil {
+		return nil, err
+	}
+
+	// The returned templates read through the watcher; the current set is a copy that
+	// is not watched so that it remains the same while an email is rendered with it.
+	first := *templates
+	w.current.Store(&first)
+	templates.watcher = w
+
+	w.wg.Add(1)
+	go w.run(interval)
+	return templates, nil
+}
+
+// LastError returns the error of the last attempt to reload the templates, or nil if
+// the templates were reloaded successfully or are not being watched.
+func (t *Templates) LastError() error {
+	if t.watcher == nil {
+		return nil
+	}
+
+	t.watcher.mu.Lock()
+	defer t.watcher.mu.Unlock()
+	return t.watcher.err
+}
+
+// OnError sets a function that is called with the error when the watched templates
+// cannot be reloaded, e.g. to log it; the last good set of templates is kept. It has no
+// effect if the templates are not watched. The templates are returned for chaining.
+func (t *Templates) OnError(fn func(error)) *Templates {
+	if t.watcher != nil {
+		t.watcher.mu.Lock()
+		defer t.watcher.mu.Unlock()
+		t.watcher.onError = fn
+	}
+	return t
+}
+
+// Close stops watching the file system if the templates were loaded by WatchTemplates;
+// the templates can still be used to render emails with the last set that was loaded.
+func (t *Templates) Close() error {
+	if t.watcher != nil {
+		t.watcher.close()
+	}
+	return nil
+}
+
+// Returns the latest set of templates that was loaded if the templates are watched.
+// The set is a snapshot that does not change so that an email renders with one version.
+func (t *Templates) current() *Templates {
+	if t.watcher == nil {
+		return t
+	}
+	return t.watcher.current.Load()
+}
+
+// Polls the file system and reloads the templates when the fingerprint of the files
+// changes. Options set on the templates (e.g. by a strict mailer) are applied to every
+// set that is reloaded.
+type watcher struct {
+	fsys        fs.FS
+	layout      Layout
+	current     atomic.Pointer[Templates]
+	fingerprint uint64
+	reloading   sync.Mutex
+	mu          sync.Mutex
+	options     [][]string
+	onError     func(error)
+	err         error
+	once        sync.Once
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+func (w *watcher) run(interval time.Duration) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+func (w *watcher) poll() {
+	sum, err := fingerprint(w.fsys, w.layout.Dir)
+	if err != nil {
+		w.failed(fmt.Errorf("could not read templates directory: %w", err))
+		return
+	}
+
+	if sum == w.fingerprint {
+		return
+	}
+	w.fingerprint = sum
+	w.reload()
+}
+
+// Loads a new set of templates and applies the options to it before it replaces the
+// current set, since the current set may be rendering emails in other goroutines.
+func (w *watcher) reload() {
+	w.reloading.Lock()
+	defer w.reloading.Unlock()
+
+	templates, err := LoadTemplates(w.fsys, w.layout)
+	if err != nil {
+		w.failed(err)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, opt := range w.options {
+		templates.setOption(opt...)
+	}
+
+	w.current.Store(templates)
+	w.err = nil
+}
+
+// Records the error and reports it to the OnError function; the last good set of
+// templates is kept.
+func (w *watcher) failed(err error) {
+	w.mu.Lock()
+	w.err = err
+	onError := w.onError
+	w.mu.Unlock()
+
+	if onError != nil {
+		onError(err)
+	}
+}
+
+// Records the options for every set that is loaded and reloads the current set with
+// them. If the templates cannot be reloaded, the error is reported and the options are
+// applied when the templates are next reloaded.
+func (w *watcher) option(opt []string) {
+	w.mu.Lock()
+	w.options = append(w.options, opt)
+	w.mu.Unlock()
+	w.reload()
+}
+
+func (w *watcher) close() {
+	w.once.Do(func() { close(w.done) })
+	w.wg.Wait()
+}
+
+// Returns a hash of the paths, sizes, and modification times of the files in the
+// directory so that any change to the templates, partials, or catalogs is detected.
+func fingerprint(fsys fs.FS, dir string) (uint64, error) {
+	h := fnv.New64a()
+	err := fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		var info fs.FileInfo
+		if info, err = d.Info(); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return h.Sum64(), err
+}
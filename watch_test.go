@@ -0,0 +1,166 @@
+package commo_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.rtnl.ai/commo"
+)
+
+func TestWatchTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "partials/base.html", `{{ define "base" }}<h1>v1</h1>{{ block "content" . }}{{ end }}{{ end }}`)
+	writeTemplate(t, dir, "welcome.html", `{{ template "base" . }}{{ define "content" }}<p>Hello {{ .Name }}</p>{{ end }}`)
+	writeTemplate(t, dir, "welcome.txt", `Hello {{ .Name }}`)
+
+	templates, err := commo.WatchTemplates(os.DirFS(dir), commo.DefaultLayout, 5*time.Millisecond)
+	require.NoError(t, err, "could not watch templates")
+	t.Cleanup(func() { templates.Close() })
+
+	m, err := commo.NewMailer(commo.Config{Strict: true}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	data := map[string]any{"Name": "Tess"}
+	rendered := func() string {
+		_, html, err := m.Render("welcome", data)
+		require.NoError(t, err, "could not render welcome")
+		return string(html)
+	}
+	require.Equal(t, "<h1>v1</h1><p>Hello Tess</p>", rendered())
+
+	// Changes to partials and templates are reloaded.
+	writeTemplate(t, dir, "partials/base.html", `{{ define "base" }}<h1>v2</h1>{{ block "content" . }}{{ end }}{{ end }}`)
+	require.Eventually(t, func() bool { return rendered() == "<h1>v2</h1><p>Hello Tess</p>" }, time.Second, 5*time.Millisecond)
+	require.NoError(t, templates.LastError())
+
+	// New templates are available after they are reloaded.
+	writeTemplate(t, dir, "goodbye.html", `<p>Goodbye {{ .Name }}</p>`)
+	writeTemplate(t, dir, "goodbye.txt", `Goodbye {{ .Name }}`)
+	require.Eventually(t, func() bool { return len(templates.Names()) == 2 }, time.Second, 5*time.Millisecond)
+	require.Equal(t, []string{"goodbye", "welcome"}, templates.Names())
+
+	// Reloaded templates keep the options that were set by the strict mailer.
+	_, _, err = m.Render("goodbye", map[string]any{})
+	require.ErrorIs(t, err, commo.ErrMissingKey)
+
+	// Parse errors keep the last good set of templates and are reported to OnError.
+	errs := make(chan error, 100)
+	templates.OnError(func(err error) { errs <- err })
+
+	writeTemplate(t, dir, "welcome.html", `{{ template "base" . }}{{ define "content" }}<p>Hello {{ .Name }</p>{{ end }}`)
+	require.Eventually(t, func() bool { return templates.LastError() != nil }, time.Second, 5*time.Millisecond)
+	require.ErrorContains(t, templates.LastError(), "could not parse template \"welcome.html\"")
+	require.ErrorContains(t, <-errs, "could not parse template \"welcome.html\"", "expected the error to be reported")
+	require.Equal(t, "<h1>v2</h1><p>Hello Tess</p>", rendered())
+
+	writeTemplate(t, dir, "welcome.html", `{{ template "base" . }}{{ define "content" }}<p>Hi {{ .Name }}</p>{{ end }}`)
+	require.Eventually(t, func() bool { return templates.LastError() == nil }, time.Second, 5*time.Millisecond)
+	require.Equal(t, "<h1>v2</h1><p>Hi Tess</p>", rendered())
+
+	// Templates are not reloaded after they are closed.
+	require.NoError(t, templates.Close())
+	writeTemplate(t, dir, "welcome.txt", `Closed {{ .Name }}`)
+	time.Sleep(20 * time.Millisecond)
+
+	text, _, err := m.Render("welcome", data)
+	require.NoError(t, err, "could not render welcome after closing")
+	require.Equal(t, "Hello Tess", string(text))
+}
+
+func TestWatchTemplatesInFlight(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "welcome.html", `<p>v1</p>`)
+	writeTemplate(t, dir, "welcome.txt", `v1`)
+
+	templates, err := commo.WatchTemplates(os.DirFS(dir), commo.DefaultLayout, 5*time.Millisecond)
+	require.NoError(t, err, "could not watch templates")
+	t.Cleanup(func() { templates.Close() })
+
+	// The first attempt changes the templates and waits for them to be reloaded before
+	// failing; the retry must render the version that the send started with.
+	var attempts []string
+	backend := backendFunc(func(_ context.Context, msg *commo.Message) error {
+		attempts = append(attempts, string(msg.Text()))
+
+		if len(attempts) == 1 {
+			writeTemplate(t, dir, "welcome.txt", `v2`)
+			require.Eventually(t, func() bool {
+				text, _, _ := commo.Render("welcome", nil)
+				return string(text) == "v2"
+			}, time.Second, 5*time.Millisecond)
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	conf := commo.Config{Sender: "test@example.com", Backoff: fastBackoff()}
+	conf.Backoff.MaxElapsedTime = 5 * time.Second
+
+	require.NoError(t, commo.InitializeWithBackend(conf, backend, templates))
+	t.Cleanup(func() { commo.Close() })
+
+	email, err := commo.New("test@example.com", "Welcome", "welcome", nil)
+	require.NoError(t, err, "could not create email")
+	require.NoError(t, email.Send(), "could not send email")
+	require.Equal(t, []string{"v1", "v1"}, attempts)
+
+	// New sends use the reloaded templates.
+	require.NoError(t, email.Send(), "could not send email")
+	require.Equal(t, "v2", attempts[2])
+}
+
+func TestWatchTemplatesOption(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "welcome.html", `<p>Hello {{ .Name }}</p>`)
+	writeTemplate(t, dir, "welcome.txt", `Hello {{ .Name }}`)
+
+	templates, err := commo.WatchTemplates(os.DirFS(dir), commo.DefaultLayout, time.Hour)
+	require.NoError(t, err, "could not watch templates")
+	t.Cleanup(func() { templates.Close() })
+
+	m, err := commo.NewMailer(commo.Config{}, templates)
+	require.NoError(t, err, "could not create mailer")
+
+	// Setting an option while the current set is rendering must not modify it; run
+	// with -race to detect concurrent writes to the published templates.
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				m.Render("welcome", map[string]any{})
+			}
+		}()
+	}
+
+	templates.Option("missingkey=error")
+	wg.Wait()
+
+	_, _, err = m.Render("welcome", map[string]any{})
+	require.ErrorIs(t, err, commo.ErrMissingKey, "expected the option to be set on the reloaded templates")
+}
+
+// Write the template and advance its modification time so that the change is seen
+// even if the file system has a coarse timestamp resolution.
+func writeTemplate(t *testing.T, dir, name, data string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+
+	var mtime time.Time
+	if info, err := os.Stat(path); err == nil {
+		mtime = info.ModTime().Add(time.Second)
+	} else {
+		mtime = time.Now()
+	}
+
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+}